@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robmorgan/go-lc3-vm/lc3"
+)
+
+// runAssembler implements the asm subcommand, which assembles a source file
+// into an object file along with its symbol table and line table. It returns
+// the exit status for the process.
+func runAssembler(args []string) int {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	outPath := flags.String("o", "", "write the object file to `file` (defaults to the source file with a .obj extension)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s asm [-o file.obj] file.asm\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	source := flags.Arg(0)
+	p, err := lc3.AssembleFile(source)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	obj := *outPath
+	if obj == "" {
+		obj = strings.TrimSuffix(source, filepath.Ext(source)) + ".obj"
+	}
+	base := strings.TrimSuffix(obj, filepath.Ext(obj))
+
+	outputs := []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{obj, p.WriteObj},
+		{base + ".sym", p.WriteSymbols},
+		{base + ".dbg", func(w io.Writer) error {
+			_, err := p.Lines.WriteTo(w)
+			return err
+		}},
+	}
+	for _, out := range outputs {
+		if err := writeFile(out.path, out.write); err != nil {
+			log.Printf("could not write %s: %v", out.path, err)
+			return exitError
+		}
+	}
+	return 0
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
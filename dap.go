@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"os"
+
+	"github.com/robmorgan/go-lc3-vm/lc3"
+)
+
+// runDAP serves a Debug Adapter Protocol session on stdin and stdout, or on a
+// single connection to addr. It returns the exit status for the process.
+func runDAP(addr string) int {
+	var conn io.ReadWriter = struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}
+
+	if addr != "stdio" {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Printf("could not listen for DAP: %v", err)
+			return exitError
+		}
+		defer l.Close()
+
+		log.Printf("Waiting for a DAP client on %s", l.Addr())
+		c, err := l.Accept()
+		if err != nil {
+			log.Printf("could not accept DAP connection: %v", err)
+			return exitError
+		}
+		defer c.Close()
+		conn = c
+	}
+
+	if err := lc3.ServeDAP(conn); err != nil {
+		log.Printf("Error: %v", err)
+		return exitError
+	}
+	return exitHalted
+}
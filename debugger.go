@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/robmorgan/go-lc3-vm/lc3"
+)
+
+const debuggerHelp = `Commands:
+  break|b LOC          set a breakpoint at an address or label
+  delete|d LOC         remove a breakpoint
+  breaks               list the breakpoints
+  step|s [N]           execute N instructions (default 1)
+  next|n               execute one instruction, stepping over subroutine calls
+  finish|fin           run until the current subroutine returns
+  continue|c           run until a breakpoint or HALT
+  back|bs [N]          reverse N instructions (default 1)
+  rcontinue|rc         run backwards until a breakpoint or the start of the history
+  goto N               move to instruction count N in the history
+  history              show the instruction counts in the history
+  save [FILE]          save a snapshot of the machine (default -snapshot file)
+  regs|r               print the registers
+  mem|x LOC [N]        print N words of memory starting at LOC (default 8)
+  set REG|LOC VALUE    set a register (R0-R7, PC, PSR) or a memory location
+  list|l [LOC]         disassemble the instructions around LOC (default PC)
+  help|h               show this help
+  quit|q               exit the debugger
+
+Locations and values may be written as x3000, 0x3000, #12, 12 or a label.
+An empty line repeats the previous command.
+`
+
+// debugSession is an interactive debugging session reading commands from a
+// terminal.
+type debugSession struct {
+	debugger     *lc3.Debugger
+	symbols      lc3.SymbolTable
+	out          io.Writer
+	snapshotPath string
+}
+
+// runDebugger runs the loaded program under the interactive debugger, reading
+// commands from in. The program's keyboard input is read from the input file,
+// since the terminal is used for commands, and snapshots are saved to
+// snapshotPath by default. It returns the exit status for the process.
+func runDebugger(cpu *lc3.CPU, symbols lc3.SymbolTable, in io.Reader, out io.Writer, inputPath, snapshotPath string) int {
+	closeInput, err := startDebugConsole(cpu, inputPath, out)
+	if err != nil {
+		log.Printf("could not open input file: %v", err)
+		return exitError
+	}
+	defer closeInput()
+
+	s := &debugSession{debugger: lc3.NewDebugger(cpu), symbols: symbols, out: out, snapshotPath: snapshotPath}
+
+	// interrupt a running program, rather than the debugger, on Ctrl-C
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			cpu.Stop()
+		}
+	}()
+
+	s.where()
+	scanner := bufio.NewScanner(in)
+	var last []string
+	for {
+		fmt.Fprint(out, "(lc3) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return exitHalted
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			args = last
+		}
+		if len(args) == 0 {
+			continue
+		}
+		last = args
+
+		if args[0] == "quit" || args[0] == "q" {
+			return exitHalted
+		}
+		if err := s.execute(args[0], args[1:]); err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
+	}
+}
+
+// startDebugConsole connects the CPU's console to the input file, or to an
+// empty input when no file is given, and to out. The returned function closes
+// the input file.
+func startDebugConsole(cpu *lc3.CPU, inputPath string, out io.Writer) (func(), error) {
+	var input io.Reader = strings.NewReader("")
+	closeInput := func() {}
+	if inputPath != "" {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			return nil, err
+		}
+		input = f
+		closeInput = func() { f.Close() }
+	}
+	cpu.Console = lc3.NewConsole(input, out)
+	go cpu.ReadConsole()
+	return closeInput, nil
+}
+
+// execute runs a single debugger command.
+func (s *debugSession) execute(cmd string, args []string) error {
+	d := s.debugger
+	switch cmd {
+	case "break", "b":
+		address, err := s.argAddress(args)
+		if err != nil {
+			return err
+		}
+		d.SetBreakpoint(address)
+		fmt.Fprintf(s.out, "Breakpoint at %s\n", s.location(address))
+	case "delete", "d":
+		address, err := s.argAddress(args)
+		if err != nil {
+			return err
+		}
+		d.ClearBreakpoint(address)
+	case "breaks":
+		for _, address := range d.Breakpoints() {
+			fmt.Fprintln(s.out, s.location(address))
+		}
+	case "step", "s":
+		count, err := s.argCount(args, "step")
+		if err != nil {
+			return err
+		}
+		for i := uint16(0); i < count; i++ {
+			reason, err := d.Step()
+			if reason != lc3.StopStep || err != nil || i == count-1 {
+				return s.stopped(reason, err)
+			}
+		}
+	case "next", "n":
+		return s.stopped(d.Next())
+	case "finish", "fin":
+		return s.stopped(d.Finish())
+	case "continue", "c":
+		return s.stopped(d.Continue())
+	case "back", "bs":
+		count, err := s.argCount(args, "back")
+		if err != nil {
+			return err
+		}
+		for i := uint16(0); i < count; i++ {
+			reason, err := d.StepBack()
+			if reason != lc3.StopStep || err != nil || i == count-1 {
+				return s.stopped(reason, err)
+			}
+		}
+	case "rcontinue", "rc":
+		return s.stopped(d.ReverseContinue())
+	case "goto":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: goto N")
+		}
+		cycle, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid instruction count %q", args[0])
+		}
+		if err := d.Goto(cycle); err != nil {
+			return err
+		}
+		s.where()
+	case "history":
+		history := d.CPU.History
+		if history == nil {
+			return lc3.ErrNoHistory
+		}
+		fmt.Fprintf(s.out, "Instructions %d to %d recorded, at %d\n", history.Oldest(), history.Newest(), d.CPU.Cycles)
+	case "regs", "r":
+		s.printRegisters()
+	case "mem", "x":
+		address, err := s.argAddress(args)
+		if err != nil {
+			return err
+		}
+		count := uint16(8)
+		if len(args) > 1 {
+			if count, err = s.parseValue(args[1]); err != nil {
+				return err
+			}
+		}
+		s.printMemory(address, count)
+	case "set":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: set REG|LOC VALUE")
+		}
+		value, err := s.parseValue(args[1])
+		if err != nil {
+			return err
+		}
+		return s.set(args[0], value)
+	case "list", "l":
+		address := d.CPU.PC
+		if len(args) > 0 {
+			var err error
+			if address, err = s.parseValue(args[0]); err != nil {
+				return err
+			}
+		}
+		for i := -5; i <= 5; i++ {
+			s.printInstruction(address + uint16(i))
+		}
+	case "save":
+		path := s.snapshotPath
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if err := saveSnapshot(d.CPU, path); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Saved snapshot to %s\n", path)
+	case "help", "h":
+		fmt.Fprint(s.out, debuggerHelp)
+	default:
+		return fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	return nil
+}
+
+// stopped reports why execution stopped and shows the next instruction.
+func (s *debugSession) stopped(reason lc3.StopReason, err error) error {
+	switch {
+	case err != nil:
+		fmt.Fprintf(s.out, "Program stopped: %v\n", err)
+	case reason == lc3.StopBreakpoint:
+		fmt.Fprintf(s.out, "Breakpoint at %s\n", s.location(s.debugger.CPU.PC))
+	case reason == lc3.StopHalted:
+		fmt.Fprintln(s.out, "Program halted")
+		return nil
+	case reason == lc3.StopInterrupted:
+		fmt.Fprintln(s.out, "Program interrupted")
+	case reason == lc3.StopHistoryStart:
+		fmt.Fprintln(s.out, "Reached the start of the history")
+	}
+	s.where()
+	return nil
+}
+
+// where shows the instruction at the PC.
+func (s *debugSession) where() {
+	s.printInstruction(s.debugger.CPU.PC)
+}
+
+// set assigns value to the register or memory location named by name.
+func (s *debugSession) set(name string, value uint16) error {
+	cpu := s.debugger.CPU
+	cpu.DiscardFuture()
+	switch strings.ToUpper(name) {
+	case "PC":
+		cpu.PC = value
+	case "PSR":
+		cpu.SetPSR(value)
+	default:
+		if reg, ok := parseRegister(name); ok {
+			cpu.Reg[reg] = value
+			return nil
+		}
+		address, err := s.parseValue(name)
+		if err != nil {
+			return err
+		}
+		cpu.Memory[address] = value
+	}
+	return nil
+}
+
+func (s *debugSession) printRegisters() {
+	cpu := s.debugger.CPU
+	for i, value := range cpu.Reg {
+		fmt.Fprintf(s.out, "R%d  x%04X  %6d", i, value, int16(value))
+		if i%2 == 1 {
+			fmt.Fprintln(s.out)
+		} else {
+			fmt.Fprint(s.out, "    ")
+		}
+	}
+
+	cc := "-"
+	switch {
+	case cpu.CondRegister.N:
+		cc = "N"
+	case cpu.CondRegister.Z:
+		cc = "Z"
+	case cpu.CondRegister.P:
+		cc = "P"
+	}
+	fmt.Fprintf(s.out, "PC  x%04X    PSR x%04X    CC  %s\n", cpu.PC, cpu.PSR(), cc)
+}
+
+func (s *debugSession) printMemory(address uint16, count uint16) {
+	for i := uint16(0); i < count; i++ {
+		if i%8 == 0 {
+			if i > 0 {
+				fmt.Fprintln(s.out)
+			}
+			fmt.Fprintf(s.out, "x%04X:", address+i)
+		}
+		fmt.Fprintf(s.out, " x%04X", s.debugger.CPU.Memory[address+i])
+	}
+	fmt.Fprintln(s.out)
+}
+
+// printInstruction prints the disassembly of the instruction at address,
+// marking the PC and breakpoints.
+func (s *debugSession) printInstruction(address uint16) {
+	cpu := s.debugger.CPU
+	marker := "  "
+	if address == cpu.PC {
+		marker = "=>"
+	}
+	for _, b := range s.debugger.Breakpoints() {
+		if b == address {
+			marker = marker[:1] + "*"
+		}
+	}
+
+	fmt.Fprintf(s.out, "%s %s\n", marker, lc3.ListingLine(address, cpu.Memory[address], s.symbols))
+}
+
+// location formats an address with its label, if it has one.
+func (s *debugSession) location(address uint16) string {
+	if label, ok := s.symbols.Label(address); ok {
+		return fmt.Sprintf("x%04X <%s>", address, label)
+	}
+	return fmt.Sprintf("x%04X", address)
+}
+
+func (s *debugSession) argAddress(args []string) (uint16, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("missing location")
+	}
+	return s.parseValue(args[0])
+}
+
+// argCount returns the optional instruction count of the step and back
+// commands, which defaults to 1.
+func (s *debugSession) argCount(args []string, cmd string) (uint16, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	count, err := s.parseValue(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("usage: %s [N], with N at least 1", cmd)
+	}
+	return count, nil
+}
+
+func (s *debugSession) parseValue(arg string) (uint16, error) {
+	return parseValue(arg, s.symbols)
+}
+
+// parseValue parses a number in LC-3 assembler notation or a label.
+func parseValue(arg string, symbols lc3.SymbolTable) (uint16, error) {
+	if address, ok := symbols[arg]; ok {
+		return address, nil
+	}
+
+	text, base := arg, 10
+	switch {
+	case strings.HasPrefix(text, "0x"), strings.HasPrefix(text, "0X"):
+		text, base = text[2:], 16
+	case strings.HasPrefix(text, "x"), strings.HasPrefix(text, "X"):
+		text, base = text[1:], 16
+	case strings.HasPrefix(text, "#"):
+		text = text[1:]
+	}
+
+	if base == 10 && strings.HasPrefix(text, "-") {
+		value, err := strconv.ParseInt(text, 10, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q", arg)
+		}
+		return uint16(value), nil
+	}
+	value, err := strconv.ParseUint(text, base, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value or unknown label %q", arg)
+	}
+	return uint16(value), nil
+}
+
+// parseRegister parses a general purpose register name such as R3.
+func parseRegister(name string) (int, bool) {
+	if len(name) != 2 || (name[0] != 'R' && name[0] != 'r') || name[1] < '0' || name[1] > '7' {
+		return 0, false
+	}
+	return int(name[1] - '0'), true
+}
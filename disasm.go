@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/robmorgan/go-lc3-vm/lc3"
+)
+
+// runDisassembler implements the disasm subcommand, which prints a listing of
+// an object file. It returns the exit status for the process.
+func runDisassembler(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	symPath := flags.String("sym", "", "read labels from the symbol table `file` (defaults to the object file's .sym file)")
+	start := flags.String("start", "", "start the listing at `address` or label instead of the origin")
+	end := flags.String("end", "", "end the listing at `address` or label instead of the end of the program")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s disasm [-sym file.sym] [-start x3000] [-end x30FF] file.obj\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitError
+	}
+
+	path := flags.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("could not open object file: %v", err)
+		return exitError
+	}
+	defer f.Close()
+	p, err := lc3.ReadObj(f)
+	if err != nil {
+		log.Printf("could not read object file: %v", err)
+		return exitError
+	}
+	if len(p.Words) == 0 {
+		return 0
+	}
+
+	// limit the listing to the requested range of addresses
+	symbols := loadSymbols(path, *symPath)
+	from, to := p.Origin, p.Origin+uint16(len(p.Words)-1)
+	if *start != "" {
+		if from, err = parseValue(*start, symbols); err != nil {
+			log.Println(err)
+			return exitError
+		}
+	}
+	if *end != "" {
+		if to, err = parseValue(*end, symbols); err != nil {
+			log.Println(err)
+			return exitError
+		}
+	}
+	if from < p.Origin || to < from || int(to) >= int(p.Origin)+len(p.Words) {
+		log.Printf("x%04X to x%04X is outside the program at x%04X to x%04X", from, to, p.Origin, p.Origin+uint16(len(p.Words)-1))
+		return exitError
+	}
+
+	// the bounds are computed as ints, since a program filling all of memory
+	// has 65536 words
+	words := p.Words[int(from-p.Origin) : int(to-p.Origin)+1]
+	if err := lc3.WriteListing(os.Stdout, from, words, symbols); err != nil {
+		log.Printf("Error: %v", err)
+		return exitError
+	}
+	return 0
+}
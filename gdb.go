@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+
+	"github.com/robmorgan/go-lc3-vm/lc3"
+)
+
+// runGDB waits for a GDB client to connect to addr and lets it debug the
+// loaded program. It returns the exit status for the process.
+func runGDB(cpu *lc3.CPU, addr string, inputPath string) int {
+	closeInput, err := startDebugConsole(cpu, inputPath, os.Stdout)
+	if err != nil {
+		log.Printf("could not open input file: %v", err)
+		return exitError
+	}
+	defer closeInput()
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Printf("could not listen for GDB: %v", err)
+		return exitError
+	}
+	defer l.Close()
+
+	log.Printf("Waiting for GDB on %s", l.Addr())
+	conn, err := l.Accept()
+	if err != nil {
+		log.Printf("could not accept GDB connection: %v", err)
+		return exitError
+	}
+	defer conn.Close()
+
+	log.Printf("GDB connected from %s", conn.RemoteAddr())
+	if err := lc3.ServeGDB(lc3.NewDebugger(cpu), conn); err != nil {
+		log.Printf("Error: %v", err)
+		return exitError
+	}
+	log.Println("Terminating VM")
+	return exitHalted
+}
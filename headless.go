@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/robmorgan/go-lc3-vm/lc3"
+)
+
+// Exit statuses reported by a headless run.
+const (
+	exitHalted  = 0 // the program executed HALT
+	exitError   = 1 // the VM stopped with an error
+	exitTimeout = 2 // the program did not halt before the timeout
+)
+
+// runHeadless runs the program without a terminal UI. Keys are read from the
+// input file, or stdin when no file is given, and output is written to
+// stdout. It returns the exit status for the process.
+func runHeadless(cpu *lc3.CPU, inputPath string, timeout time.Duration) int {
+	var in io.Reader = os.Stdin
+	if inputPath != "" {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			log.Printf("could not open input file: %v", err)
+			return exitError
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// a program restored from a snapshot taken after it halted stays halted,
+	// rather than running on past the HALT
+	if cpu.State() == lc3.RunStateHalted {
+		log.Println("The program had halted when the snapshot was taken")
+		return exitHalted
+	}
+
+	cpu.Console = lc3.NewConsole(in, os.Stdout)
+	go cpu.ReadConsole()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cpu.Run()
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return exitError
+		}
+	case <-expired:
+		cpu.Stop()
+		<-done
+		log.Printf("Timed out after %v", timeout)
+		return exitTimeout
+	}
+
+	if cpu.State() != lc3.RunStateHalted {
+		return exitError
+	}
+	log.Println("Terminating VM")
+	return exitHalted
+}
@@ -2,42 +2,87 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"sync/atomic"
 
 	"github.com/nsf/termbox-go"
+	"github.com/robmorgan/go-lc3-vm/lc3"
 )
 
-func processInput(cpu *CPU) (err error) {
+// termboxConsole is a console that reads key presses using termbox and
+// writes output to stdout.
+type termboxConsole struct {
+	cpu           *lc3.CPU
+	saveRequested int32 // set by F2 to take a snapshot, accessed atomically
+	quit          int32 // set when a key to quit is pressed, accessed atomically
+}
+
+func (t *termboxConsole) ReadKey() (rune, error) {
+	cpu := t.cpu
 	for {
 		switch ev := termbox.PollEvent(); ev.Type {
 		case termbox.EventKey:
 			if cpu.DebugMode {
 				log.Println(fmt.Sprintf("Key pressed: %d", ev.Ch))
 			}
-			cpu.keyBuffer = append(cpu.keyBuffer, ev.Ch)
 			switch {
 			case ev.Ch == 'q' || ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlC || ev.Key == termbox.KeyCtrlD:
-				instr := cpu.ReadMemory(cpu.PC)
-				op := instr >> 12
-
-				// stop the CPU from executing
+				// stop the CPU from executing. Its state is logged once Run
+				// returns, as it may still be changing now.
+				atomic.StoreInt32(&t.quit, 1)
 				cpu.Stop()
-
-				if cpu.DebugMode {
-					log.Println("========= DEBUG OUTPUT ====================")
-					log.Println(fmt.Sprintf("R0: 0x%04X", cpu.Reg[0]))
-					log.Println(fmt.Sprintf("R1: 0x%04X", cpu.Reg[1]))
-					log.Println(fmt.Sprintf("R2: 0x%04X", cpu.Reg[2]))
-					log.Println(fmt.Sprintf("R3: 0x%04X", cpu.Reg[3]))
-					log.Println(fmt.Sprintf("R4: 0x%04X", cpu.Reg[4]))
-					log.Println(fmt.Sprintf("R5: 0x%04X", cpu.Reg[5]))
-					log.Println(fmt.Sprintf("R6: 0x%04X", cpu.Reg[6]))
-					log.Println(fmt.Sprintf("R7: 0x%04X", cpu.Reg[7]))
-					log.Println(fmt.Sprintf("PC: 0x%04X", cpu.PC))
-					log.Println(fmt.Sprintf("Inst: 0x%04X Op: %d", instr, op))
-				}
-				return
+				return 0, io.EOF
+			case ev.Key == termbox.KeyF2:
+				// stop the CPU, so that the snapshot is taken between
+				// instructions
+				atomic.StoreInt32(&t.saveRequested, 1)
+				cpu.Stop()
+				continue
+			case ev.Key == termbox.KeyEnter:
+				return '\n', nil
+			case ev.Ch == 0 && ev.Key < 0x80:
+				return rune(ev.Key), nil
+			case ev.Ch == 0:
+				// ignore keys that have no ASCII equivalent
+				continue
 			}
+			return ev.Ch, nil
 		}
 	}
 }
+
+func (t *termboxConsole) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+// takeSaveRequest reports whether a snapshot has been requested since it was
+// last called.
+func (t *termboxConsole) takeSaveRequest() bool {
+	return atomic.SwapInt32(&t.saveRequested, 0) != 0
+}
+
+// quitRequested reports whether a key to quit has been pressed.
+func (t *termboxConsole) quitRequested() bool {
+	return atomic.LoadInt32(&t.quit) != 0
+}
+
+// logDebugState logs the registers and the instruction at the PC. It must
+// only be called while the CPU is not running.
+func logDebugState(cpu *lc3.CPU) {
+	instr := cpu.Memory[cpu.PC]
+	op := instr >> 12
+
+	log.Println("========= DEBUG OUTPUT ====================")
+	log.Println(fmt.Sprintf("R0: 0x%04X", cpu.Reg[0]))
+	log.Println(fmt.Sprintf("R1: 0x%04X", cpu.Reg[1]))
+	log.Println(fmt.Sprintf("R2: 0x%04X", cpu.Reg[2]))
+	log.Println(fmt.Sprintf("R3: 0x%04X", cpu.Reg[3]))
+	log.Println(fmt.Sprintf("R4: 0x%04X", cpu.Reg[4]))
+	log.Println(fmt.Sprintf("R5: 0x%04X", cpu.Reg[5]))
+	log.Println(fmt.Sprintf("R6: 0x%04X", cpu.Reg[6]))
+	log.Println(fmt.Sprintf("R7: 0x%04X", cpu.Reg[7]))
+	log.Println(fmt.Sprintf("PC: 0x%04X", cpu.PC))
+	log.Println(fmt.Sprintf("Inst: 0x%04X Op: %d", instr, op))
+}
@@ -0,0 +1,586 @@
+package lc3
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Program is an assembled LC-3 program.
+type Program struct {
+	Origin  uint16
+	Words   []uint16
+	Symbols SymbolTable
+	Lines   LineTable
+}
+
+// AssemblyError is an error in an assembly language source file.
+type AssemblyError struct {
+	File string
+	Line int
+	Err  string
+}
+
+func (e *AssemblyError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+// AssemblyErrors holds every error found in a source file.
+type AssemblyErrors []*AssemblyError
+
+func (e AssemblyErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// trapAliases are the instructions that assemble to a TRAP.
+var trapAliases = map[string]uint16{
+	"GETC":  TrapGETC,
+	"OUT":   TrapOUT,
+	"PUTS":  TrapPUTS,
+	"IN":    TrapIN,
+	"PUTSP": TrapPUTSP,
+	"HALT":  TrapHALT,
+}
+
+// asmOpcodes are the opcodes of the instructions, other than BR and the trap
+// aliases.
+var asmOpcodes = map[string]uint16{
+	"ADD": OpADD, "AND": OpAND, "NOT": OpNOT,
+	"LD": OpLD, "LDI": OpLDI, "LDR": OpLDR, "LEA": OpLEA,
+	"ST": OpST, "STI": OpSTI, "STR": OpSTR,
+	"JMP": OpJMP, "RET": OpJMP, "JSR": OpJSR, "JSRR": OpJSR,
+	"RTI": OpRTI, "TRAP": OpTRAP,
+}
+
+// statement is a line of source that assembles to one or more words.
+type statement struct {
+	line     int
+	address  uint16
+	op       string
+	operands []string
+}
+
+// assembler holds the state of a two pass assembly.
+type assembler struct {
+	file       string
+	origin     uint16
+	hasOrigin  bool
+	address    uint32
+	statements []statement
+	symbols    SymbolTable
+	errs       AssemblyErrors
+}
+
+// AssembleFile assembles an LC-3 assembly language source file.
+func AssembleFile(filename string) (*Program, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Assemble(filename, file)
+}
+
+// Assemble assembles LC-3 assembly language read from r. filename is used in
+// error messages and the line table. Errors are returned as AssemblyErrors,
+// listing every problem found along with its file and line.
+//
+// Labels are case sensitive, while opcodes, pseudo-ops and registers are not.
+// Numbers may be written in decimal (#10 or 10), hexadecimal (x0A or 0x0A) or
+// binary (b1010).
+func Assemble(filename string, r io.Reader) (*Program, error) {
+	a := &assembler{file: filename, symbols: SymbolTable{}}
+
+	// first pass: find the address of every statement and label
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if done := a.parseLine(line, scanner.Text()); done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !a.hasOrigin && len(a.errs) == 0 {
+		a.errorf(1, "missing .ORIG")
+	}
+
+	// second pass: encode the statements
+	p := &Program{Origin: a.origin, Symbols: a.symbols}
+	for _, s := range a.statements {
+		words, err := a.encode(&s)
+		if err != nil {
+			a.errorf(s.line, "%v", err)
+			continue
+		}
+		if len(words) > 0 {
+			p.Lines = append(p.Lines, LineEntry{File: filepath.Base(filename), Line: s.line, Address: s.address})
+		}
+		p.Words = append(p.Words, words...)
+	}
+
+	if len(a.errs) > 0 {
+		sort.SliceStable(a.errs, func(i, j int) bool { return a.errs[i].Line < a.errs[j].Line })
+		return nil, a.errs
+	}
+	return p, nil
+}
+
+func (a *assembler) errorf(line int, format string, args ...interface{}) {
+	a.errs = append(a.errs, &AssemblyError{File: a.file, Line: line, Err: fmt.Sprintf(format, args...)})
+}
+
+// parseLine records the label and statement on a line of source. It returns
+// true when the line holds .END.
+func (a *assembler) parseLine(line int, text string) bool {
+	fields, err := splitFields(stripComment(text))
+	if err != nil {
+		a.errorf(line, "%v", err)
+		return false
+	}
+	if len(fields) == 0 {
+		return false
+	}
+
+	// a line may start with a label
+	if !isMnemonic(fields[0]) {
+		label := strings.TrimSuffix(fields[0], ":")
+		if !isLabel(label) {
+			a.errorf(line, "invalid label or opcode %q", fields[0])
+			return false
+		}
+		if len(fields) > 1 && !isMnemonic(fields[1]) {
+			// most likely a misspelt opcode rather than a label
+			a.errorf(line, "unknown opcode %s", fields[0])
+			return false
+		}
+		if !a.hasOrigin {
+			a.errorf(line, "label %s before .ORIG", label)
+		} else if _, ok := a.symbols[label]; ok {
+			a.errorf(line, "duplicate label %s", label)
+		} else {
+			a.symbols[label] = uint16(a.address)
+		}
+		fields = fields[1:]
+		if len(fields) == 0 {
+			return false
+		}
+	}
+
+	op := strings.ToUpper(fields[0])
+	operands := fields[1:]
+	switch op {
+	case ".ORIG":
+		if a.hasOrigin {
+			a.errorf(line, "duplicate .ORIG")
+			return false
+		}
+		if len(operands) != 1 {
+			a.errorf(line, ".ORIG expects an address")
+			return false
+		}
+		origin, err := parseNumber(operands[0], 0, 0xFFFF)
+		if err != nil {
+			a.errorf(line, "%v", err)
+			return false
+		}
+		a.origin, a.address, a.hasOrigin = uint16(origin), uint32(origin), true
+		return false
+	case ".END":
+		return true
+	}
+
+	if !a.hasOrigin {
+		a.errorf(line, "%s before .ORIG", op)
+		return false
+	}
+
+	size, err := statementSize(op, operands)
+	if err != nil {
+		a.errorf(line, "%v", err)
+		return false
+	}
+	if a.address+uint32(size) > 0x10000 {
+		a.errorf(line, "program extends past the end of memory")
+		return false
+	}
+	a.statements = append(a.statements, statement{line: line, address: uint16(a.address), op: op, operands: operands})
+	a.address += uint32(size)
+	return false
+}
+
+// statementSize returns the number of words a statement assembles to.
+func statementSize(op string, operands []string) (int, error) {
+	switch op {
+	case ".BLKW":
+		if len(operands) != 1 {
+			return 0, fmt.Errorf(".BLKW expects a word count")
+		}
+		n, err := parseNumber(operands[0], 0, 0xFFFF)
+		return int(n), err
+	case ".STRINGZ":
+		if len(operands) != 1 || !strings.HasPrefix(operands[0], `"`) {
+			return 0, fmt.Errorf(".STRINGZ expects a string")
+		}
+		s, err := strconv.Unquote(operands[0])
+		if err != nil {
+			return 0, fmt.Errorf("invalid string %s", operands[0])
+		}
+		return len(s) + 1, nil
+	}
+	return 1, nil
+}
+
+// encode returns the words a statement assembles to.
+func (a *assembler) encode(s *statement) ([]uint16, error) {
+	args := s.operands
+	switch s.op {
+	case ".FILL":
+		if len(args) != 1 {
+			return nil, fmt.Errorf(".FILL expects a value")
+		}
+		if address, ok := a.symbols[args[0]]; ok {
+			return []uint16{address}, nil
+		}
+		if isLabel(args[0]) && !isNumber(args[0]) {
+			return nil, fmt.Errorf("undefined label %s", args[0])
+		}
+		value, err := parseNumber(args[0], -0x8000, 0xFFFF)
+		return []uint16{uint16(value)}, err
+	case ".BLKW":
+		n, _ := parseNumber(args[0], 0, 0xFFFF)
+		return make([]uint16, n), nil
+	case ".STRINGZ":
+		str, _ := strconv.Unquote(args[0])
+		words := make([]uint16, 0, len(str)+1)
+		for i := 0; i < len(str); i++ {
+			words = append(words, uint16(str[i]))
+		}
+		return append(words, 0), nil
+	}
+
+	if vector, ok := trapAliases[s.op]; ok {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%s takes no operands", s.op)
+		}
+		return []uint16{OpTRAP<<12 | vector}, nil
+	}
+
+	instr, err := a.encodeInstruction(s)
+	return []uint16{instr}, err
+}
+
+// encodeInstruction assembles a single instruction.
+func (a *assembler) encodeInstruction(s *statement) (uint16, error) {
+	args := s.operands
+	if strings.HasPrefix(s.op, "BR") {
+		if err := operandCount(s, 1); err != nil {
+			return 0, err
+		}
+		var flags uint16
+		for _, f := range s.op[2:] {
+			flags |= map[rune]uint16{'N': 0x800, 'Z': 0x400, 'P': 0x200}[f]
+		}
+		if flags == 0 {
+			// BR is the same as BRnzp
+			flags = 0xE00
+		}
+		offset, err := a.pcOffset(s, args[0], 9)
+		return OpBR<<12 | flags | offset, err
+	}
+
+	opcode := asmOpcodes[s.op] << 12
+	switch s.op {
+	case "ADD", "AND":
+		if err := operandCount(s, 3); err != nil {
+			return 0, err
+		}
+		dr, err1 := parseRegister(args[0])
+		sr1, err2 := parseRegister(args[1])
+		if err := firstError(err1, err2); err != nil {
+			return 0, err
+		}
+		if sr2, err := parseRegister(args[2]); err == nil {
+			return opcode | dr<<9 | sr1<<6 | sr2, nil
+		}
+		imm, err := immediate(args[2], 5)
+		return opcode | dr<<9 | sr1<<6 | 1<<5 | imm, err
+	case "NOT":
+		if err := operandCount(s, 2); err != nil {
+			return 0, err
+		}
+		dr, err1 := parseRegister(args[0])
+		sr, err2 := parseRegister(args[1])
+		return opcode | dr<<9 | sr<<6 | 0x3F, firstError(err1, err2)
+	case "LD", "LDI", "LEA", "ST", "STI":
+		if err := operandCount(s, 2); err != nil {
+			return 0, err
+		}
+		r, err1 := parseRegister(args[0])
+		offset, err2 := a.pcOffset(s, args[1], 9)
+		return opcode | r<<9 | offset, firstError(err1, err2)
+	case "LDR", "STR":
+		if err := operandCount(s, 3); err != nil {
+			return 0, err
+		}
+		r, err1 := parseRegister(args[0])
+		base, err2 := parseRegister(args[1])
+		offset, err3 := immediate(args[2], 6)
+		return opcode | r<<9 | base<<6 | offset, firstError(err1, err2, err3)
+	case "JMP", "JSRR":
+		if err := operandCount(s, 1); err != nil {
+			return 0, err
+		}
+		base, err := parseRegister(args[0])
+		return opcode | base<<6, err
+	case "RET":
+		return opcode | 7<<6, operandCount(s, 0)
+	case "JSR":
+		if err := operandCount(s, 1); err != nil {
+			return 0, err
+		}
+		offset, err := a.pcOffset(s, args[0], 11)
+		return opcode | 1<<11 | offset, err
+	case "RTI":
+		return opcode, operandCount(s, 0)
+	case "TRAP":
+		if err := operandCount(s, 1); err != nil {
+			return 0, err
+		}
+		vector, err := parseNumber(args[0], 0, 0xFF)
+		return opcode | uint16(vector), err
+	}
+	return 0, fmt.Errorf("unknown opcode %s", s.op)
+}
+
+// pcOffset returns the PC-relative offset field for a label or a literal
+// offset, checking that it fits in bits bits.
+func (a *assembler) pcOffset(s *statement, arg string, bits uint) (uint16, error) {
+	var offset int64
+	if address, ok := a.symbols[arg]; ok {
+		offset = int64(address) - int64(s.address) - 1
+	} else if isLabel(arg) && !isNumber(arg) {
+		return 0, fmt.Errorf("undefined label %s", arg)
+	} else {
+		var err error
+		if offset, err = parseNumber(arg, -1<<(bits-1), 1<<(bits-1)-1); err != nil {
+			return 0, err
+		}
+	}
+
+	if offset < -1<<(bits-1) || offset > 1<<(bits-1)-1 {
+		return 0, fmt.Errorf("%s is too far away for a %d bit offset", arg, bits)
+	}
+	return uint16(offset) & (1<<bits - 1), nil
+}
+
+// immediate parses a signed immediate operand of bits bits.
+func immediate(arg string, bits uint) (uint16, error) {
+	value, err := parseNumber(arg, -1<<(bits-1), 1<<(bits-1)-1)
+	return uint16(value) & (1<<bits - 1), err
+}
+
+func operandCount(s *statement, n int) error {
+	if len(s.operands) != n {
+		return fmt.Errorf("%s expects %d operands, found %d", s.op, n, len(s.operands))
+	}
+	return nil
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRegister parses a register operand, R0 to R7.
+func parseRegister(arg string) (uint16, error) {
+	if len(arg) != 2 || (arg[0] != 'R' && arg[0] != 'r') || arg[1] < '0' || arg[1] > '7' {
+		return 0, fmt.Errorf("expected a register, found %q", arg)
+	}
+	return uint16(arg[1] - '0'), nil
+}
+
+// parseNumber parses a numeric literal and checks that it is between min and
+// max.
+func parseNumber(arg string, min, max int64) (int64, error) {
+	text, base := arg, 10
+	switch {
+	case strings.HasPrefix(text, "#"):
+		text = text[1:]
+	case strings.HasPrefix(text, "0x"), strings.HasPrefix(text, "0X"):
+		text, base = text[2:], 16
+	case strings.HasPrefix(text, "x"), strings.HasPrefix(text, "X"):
+		text, base = text[1:], 16
+	case strings.HasPrefix(text, "b"), strings.HasPrefix(text, "B"):
+		text, base = text[1:], 2
+	}
+
+	value, err := strconv.ParseInt(text, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", arg)
+	}
+	if value < min || value > max {
+		return 0, fmt.Errorf("%s is out of range %d to %d", arg, min, max)
+	}
+	return value, nil
+}
+
+func isNumber(arg string) bool {
+	_, err := parseNumber(arg, -1<<31, 1<<31-1)
+	return err == nil
+}
+
+// isMnemonic reports whether field is an opcode, trap alias or pseudo-op.
+func isMnemonic(field string) bool {
+	op := strings.ToUpper(field)
+	if _, ok := asmOpcodes[op]; ok {
+		return true
+	}
+	if _, ok := trapAliases[op]; ok {
+		return true
+	}
+	switch op {
+	case ".ORIG", ".FILL", ".BLKW", ".STRINGZ", ".END":
+		return true
+	}
+	return isBranch(op)
+}
+
+// isBranch reports whether op is BR with optional n, z and p flags.
+func isBranch(op string) bool {
+	if !strings.HasPrefix(op, "BR") {
+		return false
+	}
+	flags := op[2:]
+	for _, f := range []string{"N", "Z", "P"} {
+		flags = strings.TrimPrefix(flags, f)
+	}
+	return flags == ""
+}
+
+// isLabel reports whether s can be used as a label.
+func isLabel(s string) bool {
+	if s == "" || !(s[0] == '_' || isLetter(s[0])) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !(s[i] == '_' || isLetter(s[i]) || (s[i] >= '0' && s[i] <= '9')) {
+			return false
+		}
+	}
+	if _, err := parseRegister(s); err == nil {
+		return false
+	}
+	// like lc3as, labels may look like binary literals, such as B1. An
+	// operand that is both refers to the label.
+	return !isMnemonic(s) && (!isNumber(s) || s[0] == 'b' || s[0] == 'B')
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// stripComment removes a comment, which starts with a semicolon outside of a
+// string.
+func stripComment(text string) string {
+	inString := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case ';':
+			if !inString {
+				return text[:i]
+			}
+		}
+	}
+	return text
+}
+
+// splitFields splits a line into fields separated by spaces or commas,
+// keeping quoted strings together.
+func splitFields(text string) ([]string, error) {
+	var fields []string
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == ' ' || c == '\t' || c == ',' || c == '\r':
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(text) && text[end] != '"'; end++ {
+				if text[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(text) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			fields = append(fields, text[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(text) && !strings.ContainsRune(" \t,\r\"", rune(text[end])) {
+				end++
+			}
+			fields = append(fields, text[i:end])
+			i = end
+		}
+	}
+	return fields, nil
+}
+
+// WriteObj writes the program in the LC-3 object file format read by
+// ReadROM: the origin followed by the program, as big-endian words.
+func (p *Program) WriteObj(w io.Writer) error {
+	if err := binary.Write(w, binary.BigEndian, p.Origin); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, p.Words)
+}
+
+// WriteSymbols writes the symbol table in the format written by lc3as.
+func (p *Program) WriteSymbols(w io.Writer) error {
+	names := make([]string, 0, len(p.Symbols))
+	for name := range p.Symbols {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if p.Symbols[names[i]] != p.Symbols[names[j]] {
+			return p.Symbols[names[i]] < p.Symbols[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	b := &strings.Builder{}
+	b.WriteString("// Symbol table\n// Scope level 0:\n//\tSymbol Name       Page Address\n//\t----------------  ------------\n")
+	for _, name := range names {
+		fmt.Fprintf(b, "//\t%-16s  %04X\n", name, p.Symbols[name])
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Load copies the program into the CPU's memory at its origin.
+func (c *CPU) Load(p *Program) {
+	copy(c.Memory[p.Origin:], p.Words)
+}
@@ -0,0 +1,155 @@
+package lc3
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	src := `; print a greeting
+        .ORIG x3000
+START   LEA R0, MSG       ; load the message
+        PUTS
+        AND R1, R1, #0
+        ADD R1, R1, #-3
+LOOP    BRzp DONE
+        ADD R1, R1, x1
+        BR LOOP
+DONE    LDR R2, R6, #-1
+        JSR SUB
+        HALT
+SUB:    RET
+PTR     .FILL START
+BUF     .BLKW 2
+MSG     .STRINGZ "Hi;\n"
+        .END
+        ADD R0, R0, R0`
+	want := []uint16{
+		0xE00D, // LEA R0, MSG
+		0xF022, // PUTS
+		0x5260, // AND R1, R1, #0
+		0x127D, // ADD R1, R1, #-3
+		0x0602, // BRzp DONE
+		0x1261, // ADD R1, R1, x1
+		0x0FFD, // BR LOOP
+		0x65BF, // LDR R2, R6, #-1
+		0x4801, // JSR SUB
+		0xF025, // HALT
+		0xC1C0, // RET
+		0x3000, // .FILL START
+		0x0000, // .BLKW 2
+		0x0000,
+		0x0048, // .STRINGZ "Hi;\n"
+		0x0069,
+		0x003B,
+		0x000A,
+		0x0000,
+	}
+
+	p, err := Assemble("test.asm", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Origin != 0x3000 {
+		t.Errorf("origin 0x%04x expected 0x3000", p.Origin)
+	}
+	if len(p.Words) != len(want) {
+		t.Fatalf("assembled %d words expected %d", len(p.Words), len(want))
+	}
+	for i, w := range want {
+		if p.Words[i] != w {
+			t.Errorf("word %d 0x%04x expected 0x%04x", i, p.Words[i], w)
+		}
+	}
+	if p.Symbols["SUB"] != 0x300A || p.Symbols["MSG"] != 0x300E {
+		t.Errorf("symbols %v expected SUB 0x300A and MSG 0x300E", p.Symbols)
+	}
+	if address, ok := p.Lines.Address("test.asm", 11); !ok || address != 0x3008 {
+		t.Errorf("line 11 at 0x%04x expected 0x3008", address)
+	}
+
+	// the object file runs
+	var obj bytes.Buffer
+	if err := p.WriteObj(&obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cpu := NewCPU()
+	if _, err := ReadROM(&obj, &cpu.Memory); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := &bytes.Buffer{}
+	cpu.Console = NewConsole(strings.NewReader(""), out)
+	cpu.Reset()
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "Hi;\n" {
+		t.Errorf("output %q expected %q", out.String(), "Hi;\n")
+	}
+
+	// the symbol table can be read back
+	var sym bytes.Buffer
+	p.WriteSymbols(&sym)
+	symbols, err := ReadSymbols(&sym)
+	if err != nil || len(symbols) != len(p.Symbols) || symbols["LOOP"] != 0x3004 {
+		t.Errorf("symbols %v expected %v", symbols, p.Symbols)
+	}
+}
+
+func TestAssembleBinaryLabels(t *testing.T) {
+	src := `        .ORIG x3000
+b1      .FILL b1
+        LD R0, B10
+B10     .FILL b101
+        .END`
+	p, err := Assemble("test.asm", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// labels that look like binary literals refer to the label
+	want := []uint16{0x3000, 0x2000, 0x0005}
+	if len(p.Words) != len(want) {
+		t.Fatalf("assembled %d words expected %d", len(p.Words), len(want))
+	}
+	for i, w := range want {
+		if p.Words[i] != w {
+			t.Errorf("word %d 0x%04x expected 0x%04x", i, p.Words[i], w)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	src := `.ORIG x3000
+	ADD R0, R0, #16
+	LD R1, NOWHERE
+LOOP	HALT
+LOOP	HALT
+	FOO R1
+	BRz #300
+	.STRINGZ "open
+.END`
+	want := []string{
+		"bad.asm:2: #16 is out of range -16 to 15",
+		"bad.asm:3: undefined label NOWHERE",
+		"bad.asm:5: duplicate label LOOP",
+		"bad.asm:6: unknown opcode FOO",
+		"bad.asm:7: #300 is out of range -256 to 255",
+		"bad.asm:8: unterminated string",
+	}
+
+	_, err := Assemble("bad.asm", strings.NewReader(src))
+	var errs AssemblyErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error %v expected AssemblyErrors", err)
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errors:\n%v\nexpected:\n%s", err, strings.Join(want, "\n"))
+	}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("error %q expected %q", e.Error(), want[i])
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package lc3
+
+import (
+	"bufio"
+	"io"
+)
+
+// Console provides the keyboard input and display output for a CPU.
+type Console interface {
+	// ReadKey blocks until a key is pressed and returns it. Returning an error
+	// stops the CPU from reading any further input from the console.
+	ReadKey() (rune, error)
+
+	// Write writes characters to the display.
+	io.Writer
+}
+
+// streamConsole is a Console backed by a reader and a writer.
+type streamConsole struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewConsole creates a Console that reads key presses from r and writes
+// output to w.
+func NewConsole(r io.Reader, w io.Writer) Console {
+	return &streamConsole{in: bufio.NewReader(r), out: w}
+}
+
+func (s *streamConsole) ReadKey() (rune, error) {
+	b, err := s.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return rune(b), nil
+}
+
+func (s *streamConsole) Write(p []byte) (int, error) {
+	return s.out.Write(p)
+}
@@ -0,0 +1,673 @@
+// Package lc3 implements a virtual machine for the LC-3 (Little Computer 3)
+// educational computer. It provides the CPU, memory and trap routines along
+// with a loader for LC-3 object files.
+package lc3
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// RunState specifies the current running state of the Processor.
+type RunState uint32
+
+const (
+	// RunStateStopped indicates that the Processor is no longer incrementing the
+	// program counter and executing instructions.
+	RunStateStopped RunState = iota
+
+	// RunStateRunning indicates that the Processor is currently executing
+	// instructions until interrupted.
+	RunStateRunning
+
+	// RunStateHalted indicates that the Processor stopped because the program
+	// cleared the clock enable bit of the Machine Control Register, normally
+	// by executing the HALT trap.
+	RunStateHalted
+)
+
+// CPU is a Processor to emulate the LC-3 CPU.
+type CPU struct {
+	Reg          [8]uint16     // registers
+	PC           uint16        // Program Counter
+	Memory       [65536]uint16 // CPU Memory
+	CondRegister *CondRegister // Condition Flags Register
+	UserMode     bool          // Privilege Mode, PSR[15]
+	Priority     uint16        // Priority Level, PSR[10:8]
+	SavedSSP     uint16        // Saved Supervisor Stack Pointer
+	SavedUSP     uint16        // Saved User Stack Pointer
+	Console      Console       // Keyboard and Display
+	osLoaded     bool          // use the trap vector table in memory
+	OSEdition    Edition       // how TRAP calls the service routines of a loaded OS
+
+	keyboard keyboard        // KBSR and KBDR
+	display  display         // DSR and DDR
+	timer    timer           // TCR, TIR and TSR
+	mcr      machineControl  // MCR
+	devices  []deviceMapping // memory mapped devices
+	idle     idleDetector    // spots loops polling KBSR
+
+	DebugMode    bool
+	DisplayDelay int // instructions before DSR is ready after a write to DDR
+
+	Tracer    Tracer       // receives a record of each instruction, if set
+	trace     *TraceRecord // record of the instruction being executed
+	traceRegs [8]uint16    // registers before the instruction being traced
+
+	History       *History      // records each instruction so that it can be reversed, if set
+	InputRecorder InputRecorder // receives each key the program reads, if set
+
+	Cycles   uint64   // Machine Cycle Counter, instructions executed
+	OP       uint16   // current opcode
+	runState RunState // current state
+	retrying bool     // the current instruction is a trap waiting for input
+	prompted bool     // the IN trap waiting for input has printed its prompt
+	instr    uint16   // the last instruction executed
+	entries  uint64   // times the PSR and PC have been pushed to enter a service routine
+}
+
+// CondRegister stores the state of the CPU condition flags register.
+type CondRegister struct {
+	P bool // Sign (S), set if the result is negative.
+	Z bool // Zero (Z), set if the result is zero.
+	N bool // Parity (P), set if the number of 1 bits in the result is even.
+}
+
+// Memory Mapped Registers
+const (
+	// Keyboard status
+	MemRegKBSR uint16 = 0xFE00
+
+	// Keyboard data
+	MemRegKBDR uint16 = 0xFE02
+
+	// Display status
+	MemRegDSR uint16 = 0xFE04
+
+	// Display data
+	MemRegDDR uint16 = 0xFE06
+
+	// Timer control
+	MemRegTCR uint16 = 0xFE08
+
+	// Timer interval
+	MemRegTIR uint16 = 0xFE0A
+
+	// Timer status
+	MemRegTSR uint16 = 0xFE0C
+
+	// Machine control
+	MemRegMCR uint16 = 0xFFFE
+)
+
+// List of OpCodes
+const (
+	OpBR   uint16 = iota // 0:  branch
+	OpADD                // 1:  add
+	OpLD                 // 2:  load
+	OpST                 // 3:  store
+	OpJSR                // 4:  jump register
+	OpAND                // 5:  bitwise and
+	OpLDR                // 6:  load register
+	OpSTR                // 7:  store register
+	OpRTI                // 8:  return from interrupt
+	OpNOT                // 9:  bitwise not
+	OpLDI                // 10: load indirect
+	OpSTI                // 11: store indrect
+	OpJMP                // 12: jump
+	OpRES                // 13: reserved (unused)
+	OpLEA                // 14: load effective address
+	OpTRAP               // 15: execute trap
+)
+
+// List of Trap codes
+const (
+	TrapGETC  uint16 = 0x20 // get character from keyboard
+	TrapOUT   uint16 = 0x21 // output a character
+	TrapPUTS  uint16 = 0x22 // output a word string
+	TrapIN    uint16 = 0x23 // input a string
+	TrapPUTSP uint16 = 0x24 // output a byte string
+	TrapHALT  uint16 = 0x25 // halt the program
+)
+
+// NewCPU creates a new instance of the CPU with the keyboard, display, timer
+// and machine control registers attached.
+func NewCPU() *CPU {
+	cpu := CPU{
+		Console: NewConsole(os.Stdin, os.Stdout),
+	}
+	cpu.display.cpu = &cpu
+	cpu.Attach(MemRegKBSR, MemRegKBDR, &cpu.keyboard)
+	cpu.Attach(MemRegDSR, MemRegDDR, &cpu.display)
+	cpu.Attach(MemRegTCR, MemRegTSR, &cpu.timer)
+	cpu.Attach(MemRegMCR, MemRegMCR, &cpu.mcr)
+	return &cpu
+}
+
+// Run executes any program loaded into memory, starting from the program
+// counter value, running until completion. The clock enable bit of the
+// Machine Control Register is set when Run starts, and the machine halts
+// once the program clears it.
+func (c *CPU) Run() (err error) {
+	if len(c.Memory) == 0 {
+		return ErrNoProgram
+	}
+
+	c.start()
+	for {
+		err = c.runStep()
+		if err != nil {
+			c.setState(RunStateStopped)
+			return
+		}
+		if c.State() != RunStateRunning {
+			return
+		}
+	}
+}
+
+// start enables the clock and puts the processor in the running state.
+func (c *CPU) start() {
+	c.mcr.value |= mcrClockEnable
+	c.setState(RunStateRunning)
+}
+
+// Reset the CPU
+func (c *CPU) Reset() {
+	// set the PC to the starting position
+	// 0x3000 is the default
+	c.PC = 0x3000
+
+	// Reset the condition register flags
+	c.CondRegister = &CondRegister{}
+
+	// Start in supervisor mode at the lowest priority, so that programs
+	// can access the memory mapped device registers, with R6 pointing at
+	// the supervisor stack for traps, interrupts and exceptions
+	c.UserMode = false
+	c.Priority = 0
+	c.Reg[6] = defaultSSP
+	c.SavedSSP = defaultSSP
+	c.SavedUSP = 0
+	c.prompted = false
+
+	// The display is ready to accept a character
+	c.display.reset()
+
+	// Start the clock
+	c.mcr.value |= mcrClockEnable
+	c.Cycles = 0
+}
+
+// Step executes the program loaded into memory
+func (c *CPU) Step() (err error) {
+	// Replay the recorded instructions once execution has been reversed
+	if h := c.History; h != nil && h.replaying && c.Cycles == h.cursor {
+		return c.replay()
+	}
+
+	c.recordHistory()
+	defer func() { c.finishHistory(err) }()
+	c.startTrace()
+
+	// Process any key presses since last time
+	err = c.ProcessInput()
+	if err != nil {
+		return
+	}
+
+	// Start the service routine of any interrupt that has been requested
+	err = c.serviceInterrupts()
+	if err != nil {
+		return
+	}
+
+	// Process the current instruction. A trap still waiting for input has
+	// not executed, so it does not count as an instruction and is retried
+	// by the next Step.
+	c.retrying = false
+	err = c.EmulateInstruction()
+	if err != nil || c.retrying {
+		c.trace = nil
+		return
+	}
+	err = c.finishTrace()
+	if err != nil {
+		return
+	}
+
+	// Let the devices update their state
+	err = c.tickDevices()
+	if err != nil {
+		return
+	}
+
+	// Increment MCC
+	c.Cycles++
+
+	// Halt once the clock has been disabled
+	if !c.mcr.clockEnabled() {
+		c.setState(RunStateHalted)
+	}
+	return
+}
+
+// Stop instructs the processor to stop processing instructions. It is safe
+// to call from any goroutine, and wakes a CPU that is waiting for a key.
+func (c *CPU) Stop() (err error) {
+	c.setState(RunStateStopped)
+	c.keyboard.queue.wake()
+	return
+}
+
+// State returns the current running state of the processor. It is safe to
+// call from any goroutine.
+func (c *CPU) State() RunState {
+	return RunState(atomic.LoadUint32((*uint32)(&c.runState)))
+}
+
+func (c *CPU) setState(state RunState) {
+	atomic.StoreUint32((*uint32)(&c.runState), uint32(state))
+}
+
+// PushKey adds a key press to the end of the keyboard queue. It is safe to
+// call from any goroutine, including while the CPU is running; the program
+// sees the key through KBSR and KBDR or the GETC and IN traps.
+func (c *CPU) PushKey(key rune) {
+	c.keyboard.queue.push(key)
+}
+
+// ReadConsole reads key presses from the console into the keyboard queue
+// until the console returns an error. It blocks, so it is normally run in its
+// own goroutine.
+func (c *CPU) ReadConsole() error {
+	for {
+		key, err := c.Console.ReadKey()
+		if err != nil {
+			c.keyboard.queue.close()
+			return err
+		}
+		c.PushKey(key)
+	}
+}
+
+// ProcessInput handles keyboard input
+func (c *CPU) ProcessInput() (err error) {
+	if err = c.checkReplay(); err != nil {
+		return
+	}
+	if key, ok := c.keyboard.update(c.Cycles); ok {
+		err = c.recordInput(key, false)
+	}
+	return
+}
+
+// ReadMemory reads an address from memory, or from the device mapped at
+// that address
+func (c *CPU) ReadMemory(address uint16) (uint16, error) {
+	if device := c.deviceAt(address); device != nil {
+		value, err := device.Read(address)
+		if err != nil {
+			return 0, c.fault(err)
+		}
+		c.traceRead(address, value)
+		return value, nil
+	}
+
+	switch {
+	case address <= 65535:
+		c.traceRead(address, c.Memory[address])
+		return uint16(c.Memory[address]), nil
+	default:
+		return 0, c.fault(ErrBadAddress)
+	}
+}
+
+// WriteMemory writes to an address in memory, or to the device mapped at
+// that address
+func (c *CPU) WriteMemory(address uint16, value uint16) error {
+	if device := c.deviceAt(address); device != nil {
+		if err := device.Write(address, value); err != nil {
+			return c.fault(err)
+		}
+		c.idle.written = true
+		c.traceWrite(address, value)
+		return nil
+	}
+
+	switch {
+	case address <= 65535:
+		c.traceWrite(address, value)
+		c.recordWrite(address, value)
+		c.Memory[address] = value
+		return nil
+	default:
+		return c.fault(ErrBadAddress)
+	}
+}
+
+// fault returns a TraceableError for err, recording the PC and the
+// instruction being executed. Errors that are already traceable are returned
+// unchanged.
+func (c *CPU) fault(err error) error {
+	var traceable *TraceableError
+	if errors.As(err, &traceable) {
+		return err
+	}
+	return newTraceableError(uint32(c.PC), c.Memory[c.PC], err)
+}
+
+// EmulateInstruction emulates the LC-3 instruction
+func (c *CPU) EmulateInstruction() (err error) {
+	var pc uint16 = c.PC + 1
+
+	if c.trace != nil {
+		c.trace.PC, c.trace.Instr = c.PC, c.Memory[c.PC]
+	}
+	c.instr = 0
+	if c.accessViolation(c.PC) {
+		return c.exception(ExcAccessViolation, pc, c.Memory[c.PC])
+	}
+	instr, err := c.ReadMemory(c.PC)
+	if err != nil {
+		return
+	}
+	c.instr = instr
+	if c.trace != nil {
+		// the fetch is traced as the instruction rather than as a read
+		c.trace.Instr = instr
+		c.trace.Reads = c.trace.Reads[:len(c.trace.Reads)-1]
+	}
+	op := instr >> 12
+
+	if c.DebugMode {
+		log.Println("Op code: ", op)
+	}
+
+	// process the current opcode
+	switch op {
+	case OpBR:
+		n := extract1C(instr, 11, 11) == 1
+		z := extract1C(instr, 10, 10) == 1
+		p := extract1C(instr, 9, 9) == 1
+		PCoffset9 := extract2C(instr, 8, 0)
+
+		if c.DebugMode {
+			brString := fmt.Sprintf("0x%04x: BR", c.PC)
+			if n {
+				brString += fmt.Sprintf("n")
+			}
+			if z {
+				brString += fmt.Sprintf("z")
+			}
+			if p {
+				brString += fmt.Sprintf("p")
+			}
+			brString += fmt.Sprintf(" #%d\n", int16(PCoffset9))
+			log.Println(brString)
+		}
+
+		if (n && c.CondRegister.N) || (z && c.CondRegister.Z) || (p && c.CondRegister.P) {
+			pc += PCoffset9
+		}
+	case OpJMP:
+		baseR := extract1C(instr, 8, 6)
+		pc = c.Reg[baseR]
+	case OpADD:
+		dr := extract1C(instr, 11, 9)
+		sr1 := extract1C(instr, 8, 6)
+		bit5 := extract1C(instr, 5, 5)
+		if bit5 == 1 {
+			imm5 := extract2C(instr, 4, 0)
+			c.Reg[dr] = c.Reg[sr1] + imm5
+		} else {
+			sr2 := extract1C(instr, 2, 0)
+			c.Reg[dr] = c.Reg[sr1] + c.Reg[sr2]
+		}
+		c.SetCC(c.Reg[dr])
+	case OpAND:
+		dr := extract1C(instr, 11, 9)
+		sr1 := extract1C(instr, 8, 6)
+		bit5 := extract1C(instr, 5, 5)
+		if bit5 == 1 {
+			imm5 := extract2C(instr, 4, 0)
+			c.Reg[dr] = c.Reg[sr1] & imm5
+		} else {
+			sr2 := extract1C(instr, 2, 0)
+			c.Reg[dr] = c.Reg[sr1] & c.Reg[sr2]
+		}
+		c.SetCC(c.Reg[dr])
+	case OpNOT:
+		dr := extract1C(instr, 11, 9)
+		sr := extract1C(instr, 8, 6)
+		c.Reg[dr] = ^c.Reg[sr]
+		c.SetCC(c.Reg[dr])
+	case OpLD:
+		dr := extract1C(instr, 11, 9)
+		PCoffset9 := extract2C(instr, 8, 0)
+		if c.accessViolation(pc + PCoffset9) {
+			return c.exception(ExcAccessViolation, pc, instr)
+		}
+		var value uint16
+		if value, err = c.ReadMemory(pc + PCoffset9); err != nil {
+			return
+		}
+		c.Reg[dr] = value
+		c.SetCC(c.Reg[dr])
+	case OpLDI:
+		dr := extract1C(instr, 11, 9)
+		PCoffset9 := extract2C(instr, 8, 0)
+		if c.accessViolation(pc + PCoffset9) {
+			return c.exception(ExcAccessViolation, pc, instr)
+		}
+		var addr uint16
+		if addr, err = c.ReadMemory(pc + PCoffset9); err != nil {
+			return
+		}
+		if c.accessViolation(addr) {
+			return c.exception(ExcAccessViolation, pc, instr)
+		}
+		var value uint16
+		if value, err = c.ReadMemory(addr); err != nil {
+			return
+		}
+		c.Reg[dr] = value
+		c.SetCC(c.Reg[dr])
+	case OpJSR:
+		bit11 := extract1C(instr, 11, 11)
+		c.Reg[7] = pc
+		if bit11 == 1 {
+			PCoffset11 := extract2C(instr, 10, 0)
+			pc += PCoffset11
+		} else {
+			baseR := extract1C(instr, 8, 6)
+			pc = c.Reg[baseR]
+		}
+	case OpLDR:
+		dr := extract1C(instr, 11, 9)
+		baseR := extract1C(instr, 8, 6)
+		offset6 := extract2C(instr, 5, 0)
+		if c.accessViolation(c.Reg[baseR] + offset6) {
+			return c.exception(ExcAccessViolation, pc, instr)
+		}
+		var value uint16
+		if value, err = c.ReadMemory(c.Reg[baseR] + offset6); err != nil {
+			return
+		}
+		c.Reg[dr] = value
+		c.SetCC(c.Reg[dr])
+	case OpLEA:
+		dr := extract1C(instr, 11, 9)
+		PCoffset9 := extract2C(instr, 8, 0)
+		c.Reg[dr] = pc + PCoffset9
+		c.SetCC(c.Reg[dr])
+	case OpST:
+		sr := extract1C(instr, 11, 9)
+		PCoffset9 := extract2C(instr, 8, 0)
+		if c.accessViolation(pc + PCoffset9) {
+			return c.exception(ExcAccessViolation, pc, instr)
+		}
+		if err = c.WriteMemory(pc+PCoffset9, c.Reg[sr]); err != nil {
+			return
+		}
+	case OpSTI:
+		sr := extract1C(instr, 11, 9)
+		PCoffset9 := extract2C(instr, 8, 0)
+		if c.accessViolation(pc + PCoffset9) {
+			return c.exception(ExcAccessViolation, pc, instr)
+		}
+		var addr uint16
+		if addr, err = c.ReadMemory(pc + PCoffset9); err != nil {
+			return
+		}
+		if c.accessViolation(addr) {
+			return c.exception(ExcAccessViolation, pc, instr)
+		}
+		if err = c.WriteMemory(addr, c.Reg[sr]); err != nil {
+			return
+		}
+	case OpSTR:
+		sr := extract1C(instr, 11, 9)
+		baseR := extract1C(instr, 8, 6)
+		offset6 := extract2C(instr, 5, 0)
+		if c.accessViolation(c.Reg[baseR] + offset6) {
+			return c.exception(ExcAccessViolation, pc, instr)
+		}
+		if err = c.WriteMemory(c.Reg[baseR]+offset6, c.Reg[sr]); err != nil {
+			return
+		}
+	case OpTRAP:
+		if c.osLoaded {
+			// jump to the service routine in the trap vector table. The 2nd
+			// edition LC-3 saves the return address in R7 for the routine to
+			// RET to, while the 3rd edition pushes the PSR and return address
+			// onto the supervisor stack for the routine to RTI to.
+			var vector uint16
+			if vector, err = c.ReadMemory(instr & 0xFF); err != nil {
+				return
+			}
+			if c.OSEdition == ThirdEdition {
+				if err = c.enterSupervisor(pc); err != nil {
+					return
+				}
+			} else {
+				c.Reg[7] = pc
+			}
+			pc = vector
+			break
+		}
+
+		var done bool
+		done, err = c.emulateTrap(instr)
+		if !done || err != nil {
+			// leave the PC on the trap so that it can be retried
+			c.retrying = err == nil
+			return
+		}
+	case OpRES:
+		// the reserved opcode raises an illegal opcode exception
+		return c.exception(ExcIllegalOpcode, pc, instr)
+	case OpRTI:
+		if c.UserMode {
+			// RTI is privileged, so raise a privilege mode violation
+			return c.exception(ExcPrivilege, pc, instr)
+		}
+		if pc, err = c.returnFromInterrupt(); err != nil {
+			return
+		}
+	default:
+		return c.fault(ErrBadOpcode)
+	}
+
+	// increment the program counter
+	c.PC = pc
+	return
+}
+
+// writeChar writes the character in the low byte of ch to the console.
+func (c *CPU) writeChar(ch uint16) error {
+	c.idle.written = true
+	if c.Console == nil {
+		return nil
+	}
+	if _, err := c.Console.Write([]byte{byte(ch)}); err != nil {
+		return c.fault(err)
+	}
+	return nil
+}
+
+func printBytes(s string) {
+	fmt.Println("printBytes:")
+	sbytes := []byte(s)
+	for i, b := range sbytes {
+		// Print the position of the byte in the string
+		// and the integer value of the byte in hexadecimal.
+		fmt.Printf("\t%2d: %2X\n", i, b)
+	}
+}
+
+func (c *CPU) SetCC(data uint16) {
+	c.CondRegister.N = isNegative(data)
+	c.CondRegister.Z = isZero(data)
+	c.CondRegister.P = isPositive(data)
+}
+
+func isPositive(data uint16) bool {
+	return int16(data) > 0
+}
+
+func isZero(data uint16) bool {
+	return data == 0
+}
+
+func isNegative(data uint16) bool {
+	return int16(data) < 0
+}
+
+func extract1C(inst uint16, hi, lo int) uint16 {
+	if hi >= 16 || hi < 0 || lo >= 16 || lo < 0 {
+		log.Println("Argument out of bounds")
+	}
+
+	//Build mask
+	mask := uint16(0)
+	for i := 0; i <= hi-lo; i++ {
+		mask = mask << 1
+		mask |= 0x0001
+	}
+	for i := 0; i < lo; i++ {
+		mask = mask << 1
+	}
+	//fmt.Printf("Mask %04x ", mask)
+
+	//Apply mask
+	field := inst & mask
+
+	//Shift field down
+	field = field >> uint(lo)
+
+	//fmt.Printf("Field %04x\n", field)
+	return field
+}
+
+func extract2C(inst uint16, hi, lo int) uint16 {
+	field := extract1C(inst, hi, lo)
+
+	if extract1C(field, hi, hi) == 1 {
+		//Build sign extension
+
+		mask := uint16(0)
+		for i := 0; i <= 15-hi; i++ {
+			mask = mask << 1
+			mask |= 0x0001
+		}
+		mask = mask << uint(hi)
+		field = inst | mask
+
+	}
+
+	return field
+}
@@ -0,0 +1,893 @@
+package lc3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCPUAddInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0x1261 // ADD R1, R1
+	m[0x3001] = 0x14A1 // ADD R2, R2, #1
+
+	cpu := NewCPU()
+	cpu.Memory = m
+	cpu.Reset()
+
+	dr := 1
+	cpu.Reg[1] = 9
+	cpu.Step()
+	if cpu.Reg[dr] != 10 {
+		t.Errorf("c.Reg[1] %v expected %v", cpu.Reg[dr], 10)
+	}
+
+	dr2 := 2
+	cpu.Step()
+	if cpu.Reg[dr2] != 1 {
+		t.Errorf("c.Reg[2] %v expected %v", cpu.Reg[dr2], 1)
+	}
+}
+
+func TestCPUBrzInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0454] = 0x6200 // LDR R1, R0, #0
+	m[0x0455] = 0x0405 // BRz x045B
+	m[0x0456] = 0xA409 // LDI R2, x0460
+	m[0x0457] = 0x07FE // BRzp x0456
+	m[0x0458] = 0xB208 // STI R1, x0461
+	m[0x0459] = 0x1021 // ADD R0, R0, #1
+	m[0x045A] = 0x0FF9 // BRnzp x0454
+
+	cpu := initCPU(m)
+	//dr := 1
+	cpu.Reg[0] = 0x3080
+	cpu.Reg[5] = 0x3017
+	cpu.Reg[6] = 0x4000
+	cpu.Reg[7] = 0x3004
+	cpu.PC = 0x0454
+
+	cpu.Step()
+	dumpCPUState(t, cpu)
+	t.FailNow()
+
+	// execute the 7 instructions above
+	for i := 0; i < 7; i++ {
+		fmt.Println("step")
+		cpu.Step()
+	}
+
+	dumpCPUState(t, cpu)
+	t.FailNow()
+
+	// We should of jumped from 0x045A back to 0x0454
+	if cpu.PC != 0x0454 {
+		dumpCPUState(t, cpu)
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x0454)
+	}
+}
+
+func TestCPUBRpInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3328] = 0x1261 // ADD R1, R1, #1
+	m[0x3329] = 0x1002 // ADD R0, R0, R2
+	m[0x332A] = 0x03FD // BRp 0x3328
+
+	cpu := initCPU(m)
+	cpu.Reg[0] = 0x1B7B
+	cpu.Reg[2] = 0xFFF0
+	cpu.Reg[5] = 0x3017
+	cpu.Reg[6] = 0x3FE7
+	cpu.Reg[7] = 0x32CA
+	cpu.PC = 0x3328
+
+	// run the necessary amount of clock cycles
+	for i := 0; i < 1319; i++ {
+		//fmt.Println("in loop")
+		cpu.Step()
+	}
+
+	if cpu.CondRegister.N != true {
+		dumpCPUState(t, cpu)
+		t.Errorf("c.CondRegister.N %v expected %v", cpu.CondRegister.N, true)
+	}
+	if cpu.Reg[1] != 0x01B8 {
+		dumpCPUState(t, cpu)
+		t.Errorf("c.Reg[1] %v expected %v", cpu.Reg[1], 0x01B8)
+	}
+}
+
+func TestCPUJmpInstr(t *testing.T) {
+	//m := [65536]uint16{}
+	//m[0x3000] = 0x5260 // AND R1, R1, #0
+
+	//cpu := initCPU(m)
+	//dr := 1
+	//cpu.Reg[1] = 2
+	//cpu.Step()
+	//if cpu.Reg[dr] != 12825 {
+	//	t.Errorf("c.Reg[1] %v expected %v", cpu.Reg[dr], 12825)
+	//}
+}
+
+func TestCPULeaInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x31E7] = 0xE031 // LEA R0, x3219
+	m[0x3219] = 0x0000
+
+	cpu := NewCPU()
+	cpu.Memory = m
+	cpu.Reset()
+	cpu.PC = 0x31E7
+
+	dr := 0
+	cpu.Step()
+	if cpu.Reg[dr] != 12825 {
+		t.Errorf("c.Reg[0] %v expected %v", cpu.Reg[dr], 12825)
+	}
+}
+
+func TestCPUAndInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0x5260 // AND R1, R1, #0
+
+	cpu := initCPU(m)
+	dr := 1
+	cpu.Reg[1] = 2
+	cpu.Step()
+	if cpu.Reg[dr] != 12825 {
+		t.Errorf("c.Reg[1] %v expected %v", cpu.Reg[dr], 12825)
+	}
+}
+
+func TestCPUJsrInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x32C6] = 0x486D // JSR 0x3334
+
+	cpu := initCPU(m)
+	cpu.PC = 0x32C6
+	cpu.Step()
+
+	if cpu.PC != 0x3334 {
+		dumpCPUState(t, cpu)
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x3334)
+	}
+
+	// TODO - test RET/JSRR
+}
+
+func TestCPULdiInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0456] = 0xA409 // LDI R2, x0460
+	m[0xFE02] = 0x8000 // RTI
+
+	cpu := initCPU(m)
+	dr := 2
+	cpu.Reg[2] = 0x8000
+	cpu.PC = 0x0456
+	cpu.Step()
+	if cpu.CondRegister.N != true {
+		t.Error("c.CondRegister.N should be true")
+	}
+	if cpu.Reg[dr] != 0x8000 {
+		t.Errorf("c.Reg[2] 0x%04x expected 0x%04x", cpu.Reg[dr], 0x8000)
+	}
+}
+
+func TestCPULdrInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0454] = 0x6200 // LDR R1, R0, #0
+
+	cpu := initCPU(m)
+	dr := 1
+	cpu.Reg[0] = 0x3080
+	cpu.PC = 0x0454
+	cpu.Step()
+	if cpu.CondRegister.P != true {
+		t.Error("c.CondRegister.P should be true")
+	}
+	if cpu.Reg[dr] != 0x0043 {
+		t.Errorf("c.Reg[1] 0x%04x expected 0x%04x", cpu.Reg[dr], 0x0043)
+	}
+}
+
+func TestCPURtiInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0500] = 0x8000 // RTI
+	m[0x2FFE] = 0x4000 // saved PC
+	m[0x2FFF] = 0x8301 // saved PSR: user mode, priority 3, P
+
+	cpu := initCPU(m)
+	cpu.PC = 0x0500
+	cpu.Reg[6] = 0x2FFE
+	cpu.SavedUSP = 0xFDFF
+	cpu.Step()
+
+	if cpu.PC != 0x4000 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x4000)
+	}
+	if cpu.PSR() != 0x8301 {
+		t.Errorf("c.PSR() 0x%04x expected 0x%04x", cpu.PSR(), 0x8301)
+	}
+	if cpu.Reg[6] != 0xFDFF {
+		t.Errorf("c.Reg[6] 0x%04x expected 0x%04x", cpu.Reg[6], 0xFDFF)
+	}
+	if cpu.SavedSSP != 0x3000 {
+		t.Errorf("c.SavedSSP 0x%04x expected 0x%04x", cpu.SavedSSP, 0x3000)
+	}
+}
+
+func TestCPURtiPrivilegeViolation(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0100] = 0x1000 // privilege mode violation handler
+	m[0x4000] = 0x8000 // RTI
+
+	cpu := initCPU(m)
+	cpu.PC = 0x4000
+	cpu.SetPSR(0x8002)
+	cpu.Reg[6] = 0xF000
+	cpu.Step()
+
+	if cpu.PC != 0x1000 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x1000)
+	}
+	if cpu.UserMode {
+		t.Error("c.UserMode should be false")
+	}
+	if cpu.Reg[6] != 0x2FFE || cpu.SavedUSP != 0xF000 {
+		t.Errorf("c.Reg[6] 0x%04x c.SavedUSP 0x%04x expected 0x2ffe 0xf000", cpu.Reg[6], cpu.SavedUSP)
+	}
+	if cpu.Memory[0x2FFE] != 0x4001 || cpu.Memory[0x2FFF] != 0x8002 {
+		t.Errorf("stack 0x%04x 0x%04x expected 0x4001 0x8002", cpu.Memory[0x2FFE], cpu.Memory[0x2FFF])
+	}
+}
+
+func TestCPUKeyboardInterrupt(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0180] = 0x1000 // keyboard interrupt service routine
+	m[0x1000] = 0xA001 // LDI R0, x1002
+	m[0x1002] = 0xFE02 // KBDR
+	m[0x3000] = 0x0000 // NOP
+
+	cpu := initCPU(m)
+	cpu.WriteMemory(MemRegKBSR, 0x4000) // enable keyboard interrupts
+	cpu.Priority = 3
+	cpu.PushKey('k')
+	cpu.Step()
+
+	if cpu.PC != 0x1001 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x1001)
+	}
+	if cpu.Reg[0] != 'k' {
+		t.Errorf("c.Reg[0] 0x%04x expected 0x%04x", cpu.Reg[0], 'k')
+	}
+	if cpu.Priority != 4 {
+		t.Errorf("c.Priority %d expected %d", cpu.Priority, 4)
+	}
+	if cpu.Reg[6] != 0x2FFE || cpu.Memory[0x2FFE] != 0x3000 || cpu.Memory[0x2FFF] != 0x0300 {
+		t.Errorf("c.Reg[6] 0x%04x stack 0x%04x 0x%04x expected 0x2ffe 0x3000 0x0300",
+			cpu.Reg[6], cpu.Memory[0x2FFE], cpu.Memory[0x2FFF])
+	}
+	if cpu.State() == RunStateHalted {
+		t.Error("the interrupt stopped the clock")
+	}
+}
+
+func TestCPUKeyboardInterruptNoHandler(t *testing.T) {
+	cpu := initCPU([65536]uint16{})
+	cpu.WriteMemory(MemRegKBSR, 0x4000) // enable keyboard interrupts
+	cpu.PushKey('k')
+	err := cpu.Step()
+
+	if !errors.Is(err, ErrNoHandler) {
+		t.Errorf("c.Step() error %v expected %v", err, ErrNoHandler)
+	}
+	if cpu.PC != 0x3000 || cpu.Priority != 0 || cpu.Reg[6] != 0x3000 {
+		t.Errorf("c.PC 0x%04x c.Priority %d c.Reg[6] 0x%04x expected 0x3000 0 0x3000", cpu.PC, cpu.Priority, cpu.Reg[6])
+	}
+}
+
+func TestCPUKeyboardInterruptPriority(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0180] = 0x1000 // keyboard interrupt service routine
+
+	cpu := initCPU(m)
+	cpu.WriteMemory(MemRegKBSR, 0x4000) // enable keyboard interrupts
+	cpu.Priority = 4
+	cpu.PushKey('k')
+	cpu.Step()
+
+	if cpu.PC != 0x3001 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x3001)
+	}
+}
+
+func TestCPUIllegalOpcode(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0101] = 0x1000 // illegal opcode handler
+	m[0x3000] = 0xD000 // reserved opcode
+
+	cpu := initCPU(m)
+	if err := cpu.Step(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cpu.PC != 0x1000 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x1000)
+	}
+
+	cpu = initCPU([65536]uint16{0x3000: 0xD000})
+	err := cpu.Run()
+	if !errors.Is(err, ErrBadOpcode) {
+		t.Errorf("c.Run() error %v expected %v", err, ErrBadOpcode)
+	}
+	var fault *TraceableError
+	if !errors.As(err, &fault) || fault.Addr != 0x3000 || fault.Opcode != 0xD000 {
+		t.Errorf("c.Run() error %#v expected a TraceableError at 0x3000", err)
+	}
+	if cpu.PC != 0x3000 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x3000)
+	}
+}
+
+func TestCPUAccessViolation(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0102] = 0x1000 // access control violation handler
+	m[0x4000] = 0xA001 // LDI R0, x4002
+	m[0x4002] = 0xFE00 // KBSR
+
+	cpu := initCPU(m)
+	cpu.PC = 0x4000
+	cpu.SetPSR(0x8002)
+	cpu.Reg[6] = 0xF000
+	if err := cpu.Step(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cpu.PC != 0x1000 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x1000)
+	}
+	if cpu.UserMode {
+		t.Error("c.UserMode should be false")
+	}
+	if cpu.Memory[0x2FFE] != 0x4001 || cpu.Memory[0x2FFF] != 0x8002 {
+		t.Errorf("stack 0x%04x 0x%04x expected 0x4001 0x8002", cpu.Memory[0x2FFE], cpu.Memory[0x2FFF])
+	}
+}
+
+// TODO - finish
+func TestCPULdInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0x1261 // ADD R1, R1
+}
+
+func TestCPUTrapPutsInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xE002 // LEA R0, x3003
+	m[0x3001] = 0xF022 // PUTS
+	m[0x3002] = 0xF021 // OUT
+	m[0x3003] = 'h'
+	m[0x3004] = 'i'
+
+	var out bytes.Buffer
+	cpu := initCPU(m)
+	cpu.Console = NewConsole(strings.NewReader(""), &out)
+	cpu.Step()
+	cpu.Step()
+	cpu.Reg[0] = '!'
+	cpu.Step()
+
+	if out.String() != "hi!" {
+		t.Errorf("console output %q expected %q", out.String(), "hi!")
+	}
+}
+
+func TestCPUTrapInInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xF023 // IN
+
+	var out bytes.Buffer
+	cpu := initCPU(m)
+	cpu.Console = NewConsole(strings.NewReader("x"), &out)
+	cpu.ReadConsole()
+	cpu.Step()
+
+	if cpu.Reg[0] != 'x' {
+		t.Errorf("c.Reg[0] 0x%04x expected 0x%04x", cpu.Reg[0], 'x')
+	}
+	if expected := "\nInput a character> x\n"; out.String() != expected {
+		t.Errorf("console output %q expected %q", out.String(), expected)
+	}
+}
+
+func TestCPUTrapInRetried(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xF023 // IN
+	m[0x3001] = 0xF023 // IN
+
+	var out bytes.Buffer
+	cpu := initCPU(m)
+	cpu.Console = NewConsole(strings.NewReader(""), &out)
+
+	// the CPU is stopped, so the trap stops waiting and is retried, without
+	// prompting again
+	for i := 0; i < 3; i++ {
+		if err := cpu.Step(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	cpu.PushKey('x')
+	cpu.Step()
+	cpu.PushKey('y')
+	cpu.Step()
+
+	if cpu.PC != 0x3002 || cpu.Reg[0] != 'y' {
+		t.Errorf("c.PC 0x%04x c.Reg[0] 0x%04x expected 0x3002 0x%04x", cpu.PC, cpu.Reg[0], 'y')
+	}
+	if expected := "\nInput a character> x\n\nInput a character> y\n"; out.String() != expected {
+		t.Errorf("console output %q expected %q", out.String(), expected)
+	}
+}
+
+func TestCPUTrapPutspInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xE002 // LEA R0, x3003
+	m[0x3001] = 0xF024 // PUTSP
+	m[0x3003] = 'e'<<8 | 'H'
+	m[0x3004] = 'l'<<8 | 'l'
+	m[0x3005] = 'o'
+	m[0x3006] = '!'
+
+	var out bytes.Buffer
+	cpu := initCPU(m)
+	cpu.Console = NewConsole(strings.NewReader(""), &out)
+	cpu.Step()
+	cpu.Step()
+
+	if out.String() != "Hello" {
+		t.Errorf("console output %q expected %q", out.String(), "Hello")
+	}
+}
+
+func TestCPUTrapVectorTable(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0025] = 0x0200 // HALT service routine
+	m[0x3000] = 0xF025 // HALT
+
+	cpu := initCPU(m)
+	cpu.osLoaded = true
+	cpu.Step()
+
+	if cpu.PC != 0x0200 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x0200)
+	}
+	// the 2nd edition saves the return address in R7 and pushes nothing
+	if cpu.Reg[7] != 0x3001 {
+		t.Errorf("c.Reg[7] 0x%04x expected 0x%04x", cpu.Reg[7], 0x3001)
+	}
+	if cpu.Reg[6] != 0x3000 || cpu.Memory[0x2FFE] != 0 || cpu.Memory[0x2FFF] != 0 {
+		t.Errorf("c.Reg[6] 0x%04x stack 0x%04x 0x%04x expected 0x3000 and nothing pushed",
+			cpu.Reg[6], cpu.Memory[0x2FFE], cpu.Memory[0x2FFF])
+	}
+	if cpu.State() == RunStateHalted {
+		t.Error("built-in HALT routine should not run when an OS is loaded")
+	}
+
+	// the 3rd edition pushes the PSR and return address instead
+	cpu = initCPU(m)
+	cpu.osLoaded = true
+	cpu.OSEdition = ThirdEdition
+	cpu.Step()
+
+	if cpu.PC != 0x0200 || cpu.Reg[7] != 0 {
+		t.Errorf("c.PC 0x%04x c.Reg[7] 0x%04x expected 0x0200 0x0000", cpu.PC, cpu.Reg[7])
+	}
+	if cpu.Reg[6] != 0x2FFE || cpu.Memory[0x2FFE] != 0x3001 || cpu.Memory[0x2FFF] != 0x0000 {
+		t.Errorf("c.Reg[6] 0x%04x stack 0x%04x 0x%04x expected 0x2ffe 0x3001 0x0000",
+			cpu.Reg[6], cpu.Memory[0x2FFE], cpu.Memory[0x2FFF])
+	}
+}
+
+func TestCPUTrapSecondEdition(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0026] = 0x0200 // service routine
+	m[0x0200] = 0x1021 // ADD R0, R0, #1
+	m[0x0201] = 0xC1C0 // RET
+	m[0x3000] = 0xF026 // TRAP x26
+	m[0x3001] = 0x1021 // ADD R0, R0, #1
+
+	cpu := initCPU(m)
+	cpu.osLoaded = true
+	for i := 0; i < 4; i++ {
+		if err := cpu.Step(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if cpu.PC != 0x3002 || cpu.Reg[0] != 2 || cpu.Reg[7] != 0x3001 || cpu.Reg[6] != 0x3000 {
+		t.Errorf("c.PC 0x%04x c.Reg[0] %d c.Reg[7] 0x%04x c.Reg[6] 0x%04x expected 0x3002 2 0x3001 0x3000",
+			cpu.PC, cpu.Reg[0], cpu.Reg[7], cpu.Reg[6])
+	}
+}
+
+func TestCPUTrapAfterReset(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0026] = 0x0200 // service routine
+	m[0x0200] = 0x1021 // ADD R0, R0, #1
+	m[0x0201] = 0x8000 // RTI
+	m[0x3000] = 0xF026 // TRAP x26
+	m[0x3001] = 0xF026 // TRAP x26
+	m[0x3002] = 0x1021 // ADD R0, R0, #1
+
+	// the traps use the supervisor stack set up by Reset
+	cpu := initCPU(m)
+	cpu.osLoaded = true
+	cpu.OSEdition = ThirdEdition
+	for i := 0; i < 7; i++ {
+		if err := cpu.Step(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if cpu.PC != 0x3003 || cpu.Reg[0] != 3 || cpu.Reg[6] != 0x3000 {
+		t.Errorf("c.PC 0x%04x c.Reg[0] %d c.Reg[6] 0x%04x expected 0x3003 3 0x3000", cpu.PC, cpu.Reg[0], cpu.Reg[6])
+	}
+	if cpu.State() == RunStateHalted || cpu.mcr.value&mcrClockEnable == 0 {
+		t.Error("the traps stopped the clock")
+	}
+}
+
+func TestCPUTrapFromUserMode(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0026] = 0x0200 // service routine
+	m[0x0200] = 0x5260 // AND R1, R1, #0
+	m[0x0201] = 0x8000 // RTI
+	m[0x3000] = 0xF026 // TRAP x26
+	m[0x3001] = 0x1261 // ADD R1, R1, #1
+
+	cpu := initCPU(m)
+	cpu.osLoaded = true
+	cpu.OSEdition = ThirdEdition
+	cpu.UserMode = true
+	cpu.Reg[1] = 5
+	cpu.Reg[6] = 0xF000
+	for i := 0; i < 4; i++ {
+		if err := cpu.Step(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if i == 0 && (cpu.UserMode || cpu.Reg[6] != 0x2FFE || cpu.SavedUSP != 0xF000) {
+			t.Errorf("in the service routine user mode %v c.Reg[6] 0x%04x c.SavedUSP 0x%04x expected false 0x2ffe 0xf000",
+				cpu.UserMode, cpu.Reg[6], cpu.SavedUSP)
+		}
+	}
+
+	if cpu.PC != 0x3002 || cpu.Reg[1] != 1 {
+		t.Errorf("c.PC 0x%04x c.Reg[1] %d expected 0x3002 1", cpu.PC, cpu.Reg[1])
+	}
+	if !cpu.UserMode || cpu.Reg[6] != 0xF000 || cpu.SavedSSP != 0x3000 {
+		t.Errorf("after returning user mode %v c.Reg[6] 0x%04x c.SavedSSP 0x%04x expected true 0xf000 0x3000",
+			cpu.UserMode, cpu.Reg[6], cpu.SavedSSP)
+	}
+}
+
+func TestReadROM(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3002] = 0xFFFF
+	obj := []byte{0x30, 0x00, 0x12, 0x61, 0xF0, 0x25}
+
+	origin, err := ReadROM(bytes.NewReader(obj), &m)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if origin != 0x3000 {
+		t.Errorf("origin 0x%04x expected 0x%04x", origin, 0x3000)
+	}
+	if m[0x3000] != 0x1261 || m[0x3001] != 0xF025 {
+		t.Errorf("memory 0x%04x 0x%04x expected 0x1261 0xf025", m[0x3000], m[0x3001])
+	}
+	if m[0x3002] != 0xFFFF {
+		t.Error("memory past the end of the program should be untouched")
+	}
+}
+
+func TestCPUDisplayOutput(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xA203 // LDI R1, x3004
+	m[0x3001] = 0x07FE // BRzp x3000
+	m[0x3002] = 0xB002 // STI R0, x3005
+	m[0x3003] = 0xF025 // HALT
+	m[0x3004] = 0xFE04 // DSR
+	m[0x3005] = 0xFE06 // DDR
+
+	var out bytes.Buffer
+	cpu := initCPU(m)
+	cpu.Console = NewConsole(strings.NewReader(""), &out)
+	cpu.DisplayDelay = 2
+	cpu.Reg[0] = 'A'
+	cpu.Run()
+	cpu.PC = 0x3000
+	cpu.Reg[0] = 'B'
+	cpu.Run()
+
+	if out.String() != "AB" {
+		t.Errorf("console output %q expected %q", out.String(), "AB")
+	}
+	if dsr, _ := cpu.ReadMemory(MemRegDSR); dsr&0x8000 != 0 {
+		t.Error("DSR should not be ready straight after a write")
+	}
+	cpu.PC = 0x3006
+	cpu.Step()
+	cpu.Step()
+	if dsr, _ := cpu.ReadMemory(MemRegDSR); dsr&0x8000 == 0 {
+		t.Error("DSR should be ready after the display delay")
+	}
+}
+
+func TestCPUTimerInterrupt(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x0181] = 0x1000 // timer interrupt service routine
+	m[0x1000] = 0xA001 // LDI R0, x1002
+	m[0x1002] = 0xFE0C // TSR
+
+	cpu := initCPU(m)
+	cpu.WriteMemory(MemRegTIR, 3)
+	cpu.WriteMemory(MemRegTCR, 0xC200) // enable, interrupts at priority 2
+
+	for i := 0; i < 3; i++ {
+		cpu.Step()
+	}
+	if cpu.PC != 0x3003 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x3003)
+	}
+
+	cpu.Step()
+	if cpu.PC != 0x1001 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x1001)
+	}
+	if cpu.Priority != 2 {
+		t.Errorf("c.Priority %d expected %d", cpu.Priority, 2)
+	}
+	// the PSR and PC are pushed onto the supervisor stack set up by Reset
+	if cpu.Reg[6] != 0x2FFE || cpu.Memory[0x2FFE] != 0x3003 || cpu.Memory[0x2FFF] != 0x0000 {
+		t.Errorf("c.Reg[6] 0x%04x stack 0x%04x 0x%04x expected 0x2ffe 0x3003 0x0000",
+			cpu.Reg[6], cpu.Memory[0x2FFE], cpu.Memory[0x2FFF])
+	}
+	if cpu.State() == RunStateHalted {
+		t.Error("the interrupt stopped the clock")
+	}
+	if cpu.Reg[0] != 0x8000 {
+		t.Errorf("c.Reg[0] 0x%04x expected 0x%04x", cpu.Reg[0], 0x8000)
+	}
+	if tsr, _ := cpu.ReadMemory(MemRegTSR); tsr != 0 {
+		t.Errorf("TSR 0x%04x expected 0x0000 after being read", tsr)
+	}
+}
+
+// counterDevice is a test device that counts up on every read.
+type counterDevice struct {
+	count uint16
+}
+
+func (d *counterDevice) Read(address uint16) (uint16, error) {
+	d.count++
+	return d.count, nil
+}
+
+func (d *counterDevice) Write(address uint16, value uint16) error {
+	d.count = value
+	return nil
+}
+
+func TestCPUAttachDevice(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xB202 // STI R1, x3003
+	m[0x3001] = 0xA001 // LDI R0, x3003
+	m[0x3003] = 0xFE10 // counter device
+
+	device := &counterDevice{}
+	cpu := initCPU(m)
+	if err := cpu.Attach(0xFE10, 0xFE10, device); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cpu.Reg[1] = 41
+	cpu.Step()
+	cpu.Step()
+
+	if cpu.Reg[0] != 42 {
+		t.Errorf("c.Reg[0] %d expected %d", cpu.Reg[0], 42)
+	}
+	if cpu.Memory[0xFE10] != 0 {
+		t.Errorf("memory at 0xfe10 0x%04x expected 0x0000", cpu.Memory[0xFE10])
+	}
+	if err := cpu.Attach(0xFE00, 0xFE01, device); err != ErrDeviceOverlap {
+		t.Errorf("c.Attach() error %v expected %v", err, ErrDeviceOverlap)
+	}
+}
+
+func TestCPUReadConsole(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xF020 // GETC
+
+	cpu := initCPU(m)
+	cpu.Console = NewConsole(strings.NewReader("a"), &bytes.Buffer{})
+	cpu.ReadConsole()
+	cpu.Step()
+
+	if cpu.Reg[0] != 'a' {
+		t.Errorf("c.Reg[0] 0x%04x expected 0x%04x", cpu.Reg[0], 'a')
+	}
+}
+
+func TestCPUHaltInstr(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xF025 // HALT
+
+	cpu := initCPU(m)
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cpu.State() != RunStateHalted {
+		t.Errorf("c.State() %v expected %v", cpu.State(), RunStateHalted)
+	}
+}
+
+func TestCPUMachineControlRegister(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0x5020 // AND R0, R0, #0
+	m[0x3001] = 0xB001 // STI R0, x3003
+	m[0x3002] = 0x0FFD // BRnzp x3000
+	m[0x3003] = 0xFFFE // MCR
+
+	cpu := initCPU(m)
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cpu.State() != RunStateHalted {
+		t.Errorf("c.State() %v expected %v", cpu.State(), RunStateHalted)
+	}
+	if cpu.PC != 0x3002 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x3002)
+	}
+	if cpu.Cycles != 2 {
+		t.Errorf("c.Cycles %d expected %d", cpu.Cycles, 2)
+	}
+	if cpu.Memory[0xFFFF] != 0 {
+		t.Errorf("memory at 0xffff 0x%04x expected 0x0000", cpu.Memory[0xFFFF])
+	}
+}
+
+func TestCPUGetcInputClosed(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xF020 // GETC
+
+	cpu := initCPU(m)
+	cpu.Console = NewConsole(strings.NewReader(""), &bytes.Buffer{})
+	cpu.ReadConsole()
+	if err := cpu.Run(); err == nil {
+		t.Error("expected an error when the input is closed")
+	}
+	if cpu.PC != 0x3000 {
+		t.Errorf("c.PC 0x%04x expected 0x%04x", cpu.PC, 0x3000)
+	}
+}
+
+func TestCPUGetcRetried(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xF020 // GETC
+
+	cpu := initCPU(m)
+	cpu.Console = NewConsole(strings.NewReader(""), &bytes.Buffer{})
+	cpu.WriteMemory(MemRegTIR, 1)
+	cpu.WriteMemory(MemRegTCR, tcrEnable)
+	cpu.History = NewHistory(10, 0)
+	var trace bytes.Buffer
+	cpu.Tracer = NewJSONTracer(&trace)
+
+	// the CPU is stopped, so the trap stops waiting without reading a key
+	if err := cpu.Step(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cpu.PC != 0x3000 || cpu.Cycles != 0 {
+		t.Errorf("c.PC 0x%04x c.Cycles %d expected 0x3000 0", cpu.PC, cpu.Cycles)
+	}
+	if cpu.timer.count != 0 || cpu.timer.status != 0 {
+		t.Errorf("timer counted %d instructions with TSR 0x%04x expected 0", cpu.timer.count, cpu.timer.status)
+	}
+	if cpu.History.Newest() != 0 || trace.Len() != 0 {
+		t.Errorf("history ends at %d with trace %q expected nothing recorded", cpu.History.Newest(), trace.String())
+	}
+}
+
+func TestCPUConcurrentInput(t *testing.T) {
+	p, err := Assemble("input.asm", strings.NewReader(`
+	.ORIG x3000
+	LD R3, COUNT
+	LEA R2, KEYS
+LOOP	GETC
+	STR R0, R2, #0
+	ADD R2, R2, #1
+	ADD R3, R3, #-1
+	BRp LOOP
+	HALT
+COUNT	.FILL #200
+KEYS	.BLKW #200
+	.END
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := NewCPU()
+	cpu.Load(p)
+	cpu.Reset()
+
+	// keys arrive through the console and PushKey while the program runs
+	r, w := io.Pipe()
+	cpu.Console = NewConsole(r, &bytes.Buffer{})
+	go cpu.ReadConsole()
+	pushed := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			cpu.PushKey('b')
+		}
+		close(pushed)
+	}()
+	go func() {
+		for i := 0; i < 100; i++ {
+			w.Write([]byte{'a'})
+		}
+		<-pushed
+		w.Close()
+	}()
+
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	counts := map[uint16]int{}
+	for _, key := range cpu.Memory[0x3009 : 0x3009+200] {
+		counts[key]++
+	}
+	if counts['a'] != 100 || counts['b'] != 100 {
+		t.Errorf("program read %d a keys and %d b keys expected 100 of each", counts['a'], counts['b'])
+	}
+}
+
+func initCPU(m [65536]uint16) *CPU {
+	cpu := NewCPU()
+	cpu.Memory = m
+	cpu.Reset()
+	return cpu
+}
+
+func dumpCPUStateE(c *CPU) {
+	fmt.Println(fmt.Sprintf("======== CPU STATE ==========="))
+	fmt.Println(fmt.Sprintf("R0: 0x%04X", c.Reg[0]))
+	fmt.Println(fmt.Sprintf("R1: 0x%04X", c.Reg[1]))
+	fmt.Println(fmt.Sprintf("R2: 0x%04X", c.Reg[2]))
+	fmt.Println(fmt.Sprintf("R3: 0x%04X", c.Reg[3]))
+	fmt.Println(fmt.Sprintf("R4: 0x%04X", c.Reg[4]))
+	fmt.Println(fmt.Sprintf("R5: 0x%04X", c.Reg[5]))
+	fmt.Println(fmt.Sprintf("R6: 0x%04X", c.Reg[6]))
+	fmt.Println(fmt.Sprintf("R7: 0x%04X", c.Reg[7]))
+	fmt.Println(fmt.Sprintf("N: %v", c.CondRegister.N))
+	fmt.Println(fmt.Sprintf("Z: %v", c.CondRegister.Z))
+	fmt.Println(fmt.Sprintf("P: %v", c.CondRegister.P))
+	fmt.Println(fmt.Sprintf("PC: 0x%04X", c.PC))
+	//t.Logf("Inst: 0x%04X Op: %d", instr, op)
+}
+
+// This method dumps the current state of the CPU in the event of a test failure.
+func dumpCPUState(t *testing.T, c *CPU) {
+	t.Logf("======== CPU STATE ===========")
+	t.Logf("R0: 0x%04X", c.Reg[0])
+	t.Logf("R1: 0x%04X", c.Reg[1])
+	t.Logf("R2: 0x%04X", c.Reg[2])
+	t.Logf("R3: 0x%04X", c.Reg[3])
+	t.Logf("R4: 0x%04X", c.Reg[4])
+	t.Logf("R5: 0x%04X", c.Reg[5])
+	t.Logf("R6: 0x%04X", c.Reg[6])
+	t.Logf("R7: 0x%04X", c.Reg[7])
+	t.Logf("N: %v", c.CondRegister.N)
+	t.Logf("Z: %v", c.CondRegister.Z)
+	t.Logf("P: %v", c.CondRegister.P)
+	t.Logf("PC: 0x%04X", c.PC)
+	//t.Logf("Inst: 0x%04X Op: %d", instr, op)
+}
@@ -0,0 +1,629 @@
+package lc3
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Reference numbers used in Debug Adapter Protocol messages. There is a single
+// thread with a single stack frame.
+const (
+	dapThreadID      = 1
+	dapFrameID       = 1
+	dapRegistersRef  = 1
+	dapMaxMemoryRead = 0x10000
+)
+
+// dapMessage is a request received from a DAP client.
+type dapMessage struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// dapLaunchArguments are the arguments of the launch request.
+type dapLaunchArguments struct {
+	Program     string `json:"program"`
+	OS          string `json:"os"`
+	Input       string `json:"input"`
+	Symbols     string `json:"symbols"`
+	LineTable   string `json:"lineTable"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+	NoDebug     bool   `json:"noDebug"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapBreakpoint struct {
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// dapServer serves a single Debug Adapter Protocol session.
+type dapServer struct {
+	r *bufio.Reader
+	w io.Writer
+
+	mu      sync.Mutex // guards w, seq and running
+	seq     int
+	running bool
+
+	debugger    *Debugger
+	symbols     SymbolTable
+	lines       LineTable
+	input       io.Closer
+	stopOnEntry bool
+	sources     map[string][]uint16 // breakpoints set in each source file
+}
+
+// ServeDAP runs a Debug Adapter Protocol session over rw, so that editors
+// such as VS Code can launch and debug LC-3 programs. It returns when the
+// client disconnects or the connection is closed.
+//
+// The launch request takes the path of the object file or assembly language
+// source file to run as "program", and optionally an operating system image
+// as "os", a file of keyboard input as "input", and the symbol table and line
+// table as "symbols" and "lineTable". The symbol and line tables of an object
+// file default to the .sym and .dbg files next to it, while source files are
+// assembled with their debug information.
+func ServeDAP(rw io.ReadWriter) error {
+	s := &dapServer{
+		r:       bufio.NewReader(rw),
+		w:       rw,
+		sources: map[string][]uint16{},
+	}
+	defer s.close()
+
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(msg)
+		if err != nil {
+			s.send(&dapResponse{Type: "response", RequestSeq: msg.Seq, Command: msg.Command, Message: err.Error()})
+			continue
+		}
+		s.send(&dapResponse{Type: "response", RequestSeq: msg.Seq, Success: true, Command: msg.Command, Body: body})
+
+		switch msg.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "configurationDone":
+			s.start()
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+// handle processes a request and returns the body of the response.
+func (s *dapServer) handle(msg *dapMessage) (interface{}, error) {
+	if msg.Command != "initialize" && msg.Command != "launch" && msg.Command != "disconnect" && s.debugger == nil {
+		return nil, errors.New("no program has been launched")
+	}
+
+	switch msg.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsStepBack":                 true,
+			"supportsReadMemoryRequest":        true,
+			"supportsDisassembleRequest":       true,
+			"supportsSetVariable":              true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args dapLaunchArguments
+		if err := json.Unmarshal(msg.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(&args)
+	case "setBreakpoints":
+		return s.setBreakpoints(msg.Arguments)
+	case "setExceptionBreakpoints":
+		return map[string]interface{}{"breakpoints": []dapBreakpoint{}}, nil
+	case "configurationDone":
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": dapThreadID, "name": "LC-3"}},
+		}, nil
+	case "continue":
+		return map[string]interface{}{"allThreadsContinued": true}, s.resume(s.debugger.Continue, "breakpoint")
+	case "next":
+		return nil, s.resume(s.debugger.Next, "step")
+	case "stepIn":
+		return nil, s.resume(s.debugger.Step, "step")
+	case "stepOut":
+		return nil, s.resume(s.debugger.Finish, "step")
+	case "stepBack":
+		return nil, s.resume(s.debugger.StepBack, "step")
+	case "reverseContinue":
+		return nil, s.resume(s.debugger.ReverseContinue, "breakpoint")
+	case "pause":
+		s.debugger.CPU.Stop()
+		return nil, nil
+	case "disconnect", "terminate":
+		if s.debugger != nil {
+			s.debugger.CPU.Stop()
+		}
+		return nil, nil
+	}
+
+	// the remaining requests inspect the stopped program
+	if s.isRunning() {
+		return nil, errors.New("the program is running")
+	}
+	switch msg.Command {
+	case "stackTrace":
+		return s.stackTrace(), nil
+	case "scopes":
+		return map[string]interface{}{
+			"scopes": []map[string]interface{}{{"name": "Registers", "variablesReference": dapRegistersRef, "expensive": false}},
+		}, nil
+	case "variables":
+		return map[string]interface{}{"variables": s.variables()}, nil
+	case "setVariable":
+		return s.setVariable(msg.Arguments)
+	case "readMemory":
+		return s.readMemory(msg.Arguments)
+	case "disassemble":
+		return s.disassemble(msg.Arguments)
+	}
+	return nil, fmt.Errorf("unsupported request %q", msg.Command)
+}
+
+// launch loads the program and its debug information.
+func (s *dapServer) launch(args *dapLaunchArguments) error {
+	if s.debugger != nil {
+		return errors.New("a program has already been launched")
+	}
+	if args.Program == "" {
+		return errors.New("no program specified")
+	}
+
+	cpu := NewCPU()
+	var input io.Reader = strings.NewReader("")
+	if args.Input != "" {
+		f, err := os.Open(args.Input)
+		if err != nil {
+			return err
+		}
+		s.input = f
+		input = f
+	}
+	cpu.Console = NewConsole(input, dapOutput{s})
+
+	if args.OS != "" {
+		if err := cpu.LoadOS(args.OS); err != nil {
+			return err
+		}
+	}
+	if strings.EqualFold(filepath.Ext(args.Program), ".asm") {
+		// assemble the program, which provides the debug information
+		p, err := AssembleFile(args.Program)
+		if err != nil {
+			return err
+		}
+		cpu.Load(p)
+		s.symbols, s.lines = p.Symbols, p.Lines
+		for i := range s.lines {
+			s.lines[i].File = args.Program
+		}
+		return s.started(cpu, args)
+	}
+	if _, err := cpu.LoadROM(args.Program); err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(args.Program, filepath.Ext(args.Program))
+	s.symbols = SymbolTable{}
+	if path := debugFile(args.Symbols, base+".sym"); path != "" {
+		symbols, err := LoadSymbols(path)
+		if err != nil {
+			return err
+		}
+		s.symbols = symbols
+	}
+	if path := debugFile(args.LineTable, base+".dbg"); path != "" {
+		lines, err := LoadLineTable(path)
+		if err != nil {
+			return err
+		}
+		s.lines = lines
+	}
+	return s.started(cpu, args)
+}
+
+// started finishes launching the program loaded into cpu.
+func (s *dapServer) started(cpu *CPU, args *dapLaunchArguments) error {
+	go cpu.ReadConsole()
+	cpu.Reset()
+	cpu.History = NewHistory(DefaultHistorySize, DefaultCheckpointInterval)
+	s.debugger = NewDebugger(cpu)
+	s.stopOnEntry = args.StopOnEntry && !args.NoDebug
+	return nil
+}
+
+// debugFile returns path, or defaultPath if path is empty and a file exists
+// there.
+func debugFile(path, defaultPath string) string {
+	if path != "" {
+		return path
+	}
+	if _, err := os.Stat(defaultPath); err != nil {
+		return ""
+	}
+	return defaultPath
+}
+
+// start begins execution once the client has finished configuring the
+// session.
+func (s *dapServer) start() {
+	if s.stopOnEntry {
+		s.event("stopped", map[string]interface{}{"reason": "entry", "threadId": dapThreadID})
+		return
+	}
+	s.resume(s.debugger.Continue, "breakpoint")
+}
+
+// resume runs the program in the background using run, and reports why it
+// stopped. stopped is the reason given when run completes normally.
+func (s *dapServer) resume(run func() (StopReason, error), stopped string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return errors.New("the program is already running")
+	}
+	s.running = true
+
+	go func() {
+		reason, err := run()
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+
+		switch {
+		case err != nil:
+			s.event("stopped", map[string]interface{}{
+				"reason": "exception", "threadId": dapThreadID, "description": "Exception", "text": err.Error(),
+			})
+		case reason == StopHalted:
+			s.event("exited", map[string]interface{}{"exitCode": 0})
+			s.event("terminated", nil)
+		case reason == StopInterrupted:
+			s.event("stopped", map[string]interface{}{"reason": "pause", "threadId": dapThreadID})
+		case reason == StopBreakpoint:
+			s.event("stopped", map[string]interface{}{"reason": "breakpoint", "threadId": dapThreadID})
+		case reason == StopHistoryStart:
+			s.event("stopped", map[string]interface{}{
+				"reason": "step", "threadId": dapThreadID, "description": "Reached the start of the history",
+			})
+		default:
+			s.event("stopped", map[string]interface{}{"reason": stopped, "threadId": dapThreadID})
+		}
+	}()
+	return nil
+}
+
+func (s *dapServer) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// setBreakpoints replaces the breakpoints in a source file.
+func (s *dapServer) setBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source      dapSource `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	for _, address := range s.sources[args.Source.Path] {
+		s.debugger.ClearBreakpoint(address)
+	}
+
+	var addresses []uint16
+	breakpoints := []dapBreakpoint{}
+	for _, b := range args.Breakpoints {
+		address, ok := s.lines.Address(args.Source.Path, b.Line)
+		if !ok {
+			breakpoints = append(breakpoints, dapBreakpoint{Line: b.Line, Message: "no instruction at this line"})
+			continue
+		}
+		s.debugger.SetBreakpoint(address)
+		addresses = append(addresses, address)
+		breakpoints = append(breakpoints, dapBreakpoint{Verified: true, Line: b.Line})
+	}
+	s.sources[args.Source.Path] = addresses
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// stackTrace returns the single frame for the current PC.
+func (s *dapServer) stackTrace() interface{} {
+	cpu := s.debugger.CPU
+	name := Disassemble(cpu.PC, cpu.Memory[cpu.PC])
+	if label, ok := s.symbols.Label(cpu.PC); ok {
+		name = label + ": " + name
+	}
+
+	frame := map[string]interface{}{
+		"id":                          dapFrameID,
+		"name":                        name,
+		"line":                        0,
+		"column":                      0,
+		"instructionPointerReference": fmt.Sprintf("0x%04X", cpu.PC),
+	}
+	if entry, ok := s.lines.Line(cpu.PC); ok {
+		frame["line"] = entry.Line
+		frame["column"] = 1
+		frame["source"] = dapSource{Name: filepath.Base(entry.File), Path: entry.File}
+	}
+	return map[string]interface{}{"stackFrames": []interface{}{frame}, "totalFrames": 1}
+}
+
+// variables returns the registers.
+func (s *dapServer) variables() []map[string]interface{} {
+	cpu := s.debugger.CPU
+	variable := func(name string, value uint16) map[string]interface{} {
+		return map[string]interface{}{
+			"name":               name,
+			"value":              fmt.Sprintf("x%04X (%d)", value, int16(value)),
+			"variablesReference": 0,
+			"memoryReference":    fmt.Sprintf("0x%04X", value),
+		}
+	}
+
+	var variables []map[string]interface{}
+	for i, value := range cpu.Reg {
+		variables = append(variables, variable(fmt.Sprintf("R%d", i), value))
+	}
+	variables = append(variables, variable("PC", cpu.PC), variable("PSR", cpu.PSR()))
+	return variables
+}
+
+// setVariable sets a register.
+func (s *dapServer) setVariable(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	value, err := parseDAPValue(args.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	cpu := s.debugger.CPU
+	cpu.DiscardFuture()
+	switch name := strings.ToUpper(args.Name); {
+	case name == "PC":
+		cpu.PC = value
+	case name == "PSR":
+		cpu.SetPSR(value)
+	case len(name) == 2 && name[0] == 'R' && name[1] >= '0' && name[1] <= '7':
+		cpu.Reg[name[1]-'0'] = value
+	default:
+		return nil, fmt.Errorf("unknown register %q", args.Name)
+	}
+	return map[string]interface{}{"value": fmt.Sprintf("x%04X (%d)", value, int16(value))}, nil
+}
+
+// readMemory returns memory contents. Memory references are word addresses
+// and the data is returned as big-endian words, so offset and count are in
+// bytes.
+func (s *dapServer) readMemory(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	address, err := parseDAPValue(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+
+	start := int(address)*2 + args.Offset
+	if args.Count > dapMaxMemoryRead {
+		args.Count = dapMaxMemoryRead
+	}
+	data := make([]byte, args.Count)
+	for i := range data {
+		b := start + i
+		word := s.debugger.CPU.Memory[uint16(b/2)]
+		if b%2 == 0 {
+			data[i] = byte(word >> 8)
+		} else {
+			data[i] = byte(word)
+		}
+	}
+	return map[string]interface{}{
+		"address": fmt.Sprintf("0x%04X", uint16(start/2)),
+		"data":    base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+// disassemble returns the disassembly of a range of instructions.
+func (s *dapServer) disassemble(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference   string `json:"memoryReference"`
+		InstructionOffset int    `json:"instructionOffset"`
+		InstructionCount  int    `json:"instructionCount"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	address, err := parseDAPValue(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+
+	cpu := s.debugger.CPU
+	instructions := []map[string]interface{}{}
+	for i := 0; i < args.InstructionCount && i < dapMaxMemoryRead; i++ {
+		a := address + uint16(args.InstructionOffset+i)
+		instruction := map[string]interface{}{
+			"address":          fmt.Sprintf("0x%04X", a),
+			"instructionBytes": fmt.Sprintf("%04X", cpu.Memory[a]),
+			"instruction":      Disassemble(a, cpu.Memory[a]),
+		}
+		if label, ok := s.symbols.Label(a); ok {
+			instruction["symbol"] = label
+		}
+		if entry, ok := s.lines.Line(a); ok {
+			instruction["location"] = dapSource{Name: filepath.Base(entry.File), Path: entry.File}
+			instruction["line"] = entry.Line
+		}
+		instructions = append(instructions, instruction)
+	}
+	return map[string]interface{}{"instructions": instructions}, nil
+}
+
+// parseDAPValue parses a value entered in the client, in hexadecimal with a 0x
+// or x prefix, or in decimal.
+func parseDAPValue(text string) (uint16, error) {
+	text = strings.TrimSpace(text)
+	lower := strings.ToLower(text)
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		value, err := strconv.ParseUint(lower[2:], 16, 16)
+		return uint16(value), err
+	case strings.HasPrefix(lower, "x"):
+		value, err := strconv.ParseUint(lower[1:], 16, 16)
+		return uint16(value), err
+	}
+	value, err := strconv.ParseInt(strings.TrimPrefix(text, "#"), 10, 32)
+	if err != nil || value < -0x8000 || value > 0xFFFF {
+		return 0, fmt.Errorf("invalid value %q", text)
+	}
+	return uint16(value), nil
+}
+
+// read reads the next message from the client.
+func (s *dapServer) read() (*dapMessage, error) {
+	length := -1
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Content-Length:") {
+			if length, err = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Content-Length:"))); err != nil {
+				return nil, fmt.Errorf("invalid content length %q", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message has no content length")
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(s.r, content); err != nil {
+		return nil, err
+	}
+	msg := &dapMessage{}
+	if err := json.Unmarshal(content, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// send writes a response or event to the client, assigning its sequence
+// number.
+func (s *dapServer) send(msg interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	switch m := msg.(type) {
+	case *dapResponse:
+		m.Seq = s.seq
+	case *dapEvent:
+		m.Seq = s.seq
+	}
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+func (s *dapServer) event(event string, body interface{}) error {
+	return s.send(&dapEvent{Type: "event", Event: event, Body: body})
+}
+
+// close stops the program and releases the input file.
+func (s *dapServer) close() {
+	if s.debugger != nil {
+		s.debugger.CPU.Stop()
+	}
+	if s.input != nil {
+		s.input.Close()
+	}
+}
+
+// dapOutput sends the program's console output to the client.
+type dapOutput struct {
+	s *dapServer
+}
+
+func (o dapOutput) Write(p []byte) (int, error) {
+	if err := o.s.event("output", map[string]interface{}{"category": "stdout", "output": string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,167 @@
+package lc3
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDAPServer(t *testing.T) {
+	dir := t.TempDir()
+	words := []uint16{
+		0x3000,
+		0x1025, // ADD R0, R0, #5
+		0x1021, // ADD R0, R0, #1
+		0xF025, // HALT
+	}
+	obj, _ := os.Create(filepath.Join(dir, "prog.obj"))
+	binary.Write(obj, binary.BigEndian, words)
+	obj.Close()
+	os.WriteFile(filepath.Join(dir, "prog.dbg"), []byte("prog.asm 2 3000\nprog.asm 3 3001\nprog.asm 4 3002\n"), 0644)
+
+	server, conn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeDAP(server)
+	}()
+	c := newDAPTestClient(t, conn)
+
+	c.call("initialize", map[string]interface{}{"adapterID": "lc3"})
+	c.event("initialized")
+	c.call("launch", map[string]interface{}{"program": filepath.Join(dir, "prog.obj"), "stopOnEntry": true})
+
+	body := c.call("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": filepath.Join(dir, "prog.asm")},
+		"breakpoints": []map[string]interface{}{{"line": 3}, {"line": 9}},
+	})
+	breakpoints := body["breakpoints"].([]interface{})
+	if len(breakpoints) != 2 || breakpoints[0].(map[string]interface{})["verified"] != true || breakpoints[1].(map[string]interface{})["verified"] != false {
+		t.Errorf("breakpoints %v expected line 3 verified and line 9 not", breakpoints)
+	}
+
+	c.call("configurationDone", nil)
+	if reason := c.event("stopped")["reason"]; reason != "entry" {
+		t.Errorf("stopped with %v expected entry", reason)
+	}
+
+	c.call("continue", map[string]interface{}{"threadId": 1})
+	if reason := c.event("stopped")["reason"]; reason != "breakpoint" {
+		t.Errorf("stopped with %v expected breakpoint", reason)
+	}
+
+	frames := c.call("stackTrace", map[string]interface{}{"threadId": 1})["stackFrames"].([]interface{})
+	if line := frames[0].(map[string]interface{})["line"]; line != 3.0 {
+		t.Errorf("stopped at line %v expected 3", line)
+	}
+
+	variables := c.call("variables", map[string]interface{}{"variablesReference": 1})["variables"].([]interface{})
+	if r0 := variables[0].(map[string]interface{}); r0["name"] != "R0" || r0["value"] != "x0005 (5)" {
+		t.Errorf("variable %v expected R0 = x0005 (5)", r0)
+	}
+
+	memory := c.call("readMemory", map[string]interface{}{"memoryReference": "0x3000", "count": 4})
+	if memory["data"] != "ECUQIQ==" {
+		t.Errorf("memory %v expected ECUQIQ==", memory["data"])
+	}
+
+	c.call("next", map[string]interface{}{"threadId": 1})
+	if reason := c.event("stopped")["reason"]; reason != "step" {
+		t.Errorf("stopped with %v expected step", reason)
+	}
+
+	c.call("continue", map[string]interface{}{"threadId": 1})
+	c.event("terminated")
+
+	c.call("disconnect", nil)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// dapTestClient drives a DAP server from a test.
+type dapTestClient struct {
+	t        *testing.T
+	conn     net.Conn
+	messages chan map[string]interface{}
+	events   []map[string]interface{}
+	seq      int
+}
+
+func newDAPTestClient(t *testing.T, conn net.Conn) *dapTestClient {
+	c := &dapTestClient{t: t, conn: conn, messages: make(chan map[string]interface{}, 100)}
+
+	// read in the background so the server never blocks writing events
+	go func() {
+		defer close(c.messages)
+		r := bufio.NewReader(conn)
+		for {
+			var length int
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line = strings.TrimSpace(line); line == "" {
+					break
+				}
+				fmt.Sscanf(line, "Content-Length: %d", &length)
+			}
+			content := make([]byte, length)
+			if _, err := io.ReadFull(r, content); err != nil {
+				return
+			}
+			var msg map[string]interface{}
+			json.Unmarshal(content, &msg)
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+// call sends a request and returns the body of its response.
+func (c *dapTestClient) call(command string, args interface{}) map[string]interface{} {
+	c.seq++
+	content, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(content), content)
+
+	for msg := range c.messages {
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg["success"] != true {
+			c.t.Fatalf("%s request failed: %v", command, msg["message"])
+		}
+		body, _ := msg["body"].(map[string]interface{})
+		return body
+	}
+	c.t.Fatalf("connection closed waiting for %s response", command)
+	return nil
+}
+
+// event waits for the named event and returns its body.
+func (c *dapTestClient) event(name string) map[string]interface{} {
+	for len(c.events) > 0 {
+		msg := c.events[0]
+		c.events = c.events[1:]
+		if msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+	for msg := range c.messages {
+		if msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+	c.t.Fatalf("connection closed waiting for %s event", name)
+	return nil
+}
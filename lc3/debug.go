@@ -0,0 +1,199 @@
+package lc3
+
+import (
+	"sort"
+	"sync"
+)
+
+// StopReason describes why the debugger stopped executing instructions.
+type StopReason int
+
+const (
+	// StopStep indicates that the requested step completed.
+	StopStep StopReason = iota
+
+	// StopBreakpoint indicates that execution reached a breakpoint.
+	StopBreakpoint
+
+	// StopHalted indicates that the program halted the machine.
+	StopHalted
+
+	// StopInterrupted indicates that the CPU was stopped with Stop, or
+	// that an instruction returned an error.
+	StopInterrupted
+
+	// StopHistoryStart indicates that reverse execution reached the oldest
+	// instruction in the CPU's History.
+	StopHistoryStart
+)
+
+// Debugger controls the execution of a CPU for interactive debugging. It
+// supports breakpoints and stepping over and out of subroutines. Breakpoints
+// may be changed while the program is running.
+type Debugger struct {
+	CPU         *CPU
+	mu          sync.Mutex // guards breakpoints
+	breakpoints map[uint16]bool
+}
+
+// NewDebugger creates a debugger for the CPU.
+func NewDebugger(cpu *CPU) *Debugger {
+	return &Debugger{CPU: cpu, breakpoints: map[uint16]bool{}}
+}
+
+// SetBreakpoint sets a breakpoint at address.
+func (d *Debugger) SetBreakpoint(address uint16) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints[address] = true
+}
+
+// ClearBreakpoint removes the breakpoint at address.
+func (d *Debugger) ClearBreakpoint(address uint16) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.breakpoints, address)
+}
+
+// Breakpoints returns the addresses of the breakpoints in ascending order.
+func (d *Debugger) Breakpoints() []uint16 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	addresses := make([]uint16, 0, len(d.breakpoints))
+	for address := range d.breakpoints {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+	return addresses
+}
+
+func (d *Debugger) hasBreakpoint(address uint16) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.breakpoints[address]
+}
+
+// Step executes a single instruction.
+func (d *Debugger) Step() (StopReason, error) {
+	return d.run(func(instr uint16) bool { return true })
+}
+
+// Next executes a single instruction, running subroutine calls, and traps
+// that jump into the operating system, until they return.
+func (d *Debugger) Next() (StopReason, error) {
+	c := d.CPU
+	op := c.Memory[c.PC] >> 12
+	if op != OpJSR && !(op == OpTRAP && c.osLoaded) {
+		return d.Step()
+	}
+
+	ret := c.PC + 1
+	return d.run(func(instr uint16) bool { return c.PC == ret })
+}
+
+// Finish runs until the current subroutine or service routine returns.
+// Subroutine calls, and traps into a 2nd edition operating system, return
+// with RET, while traps into a 3rd edition operating system, interrupts and
+// exceptions push the PSR and PC and return with RTI, so each of them is run
+// until it returns.
+func (d *Debugger) Finish() (StopReason, error) {
+	c := d.CPU
+	depth := 0
+	entries := c.entries
+	return d.run(func(instr uint16) bool {
+		depth += int(c.entries - entries)
+		entries = c.entries
+		switch {
+		case instr>>12 == OpJSR, instr>>12 == OpTRAP && c.trapCalls():
+			depth++
+		case isReturn(instr), instr>>12 == OpRTI:
+			if depth == 0 {
+				return true
+			}
+			depth--
+		}
+		return false
+	})
+}
+
+// Continue runs until a breakpoint is reached or the program halts.
+func (d *Debugger) Continue() (StopReason, error) {
+	return d.run(func(instr uint16) bool { return false })
+}
+
+// StepBack reverses the last instruction executed. The CPU must be
+// recording a History.
+func (d *Debugger) StepBack() (StopReason, error) {
+	return d.reverse(func() bool { return true })
+}
+
+// ReverseContinue runs backwards until a breakpoint is reached or the start
+// of the CPU's History.
+func (d *Debugger) ReverseContinue() (StopReason, error) {
+	return d.reverse(func() bool { return false })
+}
+
+// Goto moves execution backwards or forwards to the instruction at cycle in
+// the CPU's History.
+func (d *Debugger) Goto(cycle uint64) error {
+	return d.CPU.Rewind(cycle)
+}
+
+// reverse reverses instructions until done returns true, a breakpoint is
+// reached, the start of the history is reached or the CPU is stopped.
+func (d *Debugger) reverse(done func() bool) (StopReason, error) {
+	c := d.CPU
+	if c.History == nil {
+		return StopInterrupted, ErrNoHistory
+	}
+	c.setState(RunStateRunning)
+	defer c.rewound()
+
+	for {
+		if err := c.StepBack(); err != nil {
+			return StopHistoryStart, nil
+		}
+		if c.State() == RunStateStopped {
+			return StopInterrupted, nil
+		}
+		if done() {
+			return StopStep, nil
+		}
+		if d.hasBreakpoint(c.PC) {
+			return StopBreakpoint, nil
+		}
+	}
+}
+
+// run executes instructions until done returns true for the instruction that
+// was just executed, a breakpoint is reached, the machine halts or the CPU is
+// stopped.
+func (d *Debugger) run(done func(instr uint16) bool) (StopReason, error) {
+	c := d.CPU
+	c.start()
+	defer func() {
+		if c.State() == RunStateRunning {
+			c.setState(RunStateStopped)
+		}
+	}()
+
+	for {
+		if err := c.runStep(); err != nil {
+			c.setState(RunStateStopped)
+			return StopInterrupted, err
+		}
+
+		switch c.State() {
+		case RunStateHalted:
+			return StopHalted, nil
+		case RunStateStopped:
+			return StopInterrupted, nil
+		}
+		if done(c.instr) {
+			return StopStep, nil
+		}
+		if d.hasBreakpoint(c.PC) {
+			return StopBreakpoint, nil
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package lc3
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebuggerBreakpoint(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0x1021 // ADD R0, R0, #1
+	m[0x3001] = 0x1021 // ADD R0, R0, #1
+	m[0x3002] = 0x1021 // ADD R0, R0, #1
+	m[0x3003] = 0xF025 // HALT
+
+	d := NewDebugger(initCPU(m))
+	d.SetBreakpoint(0x3002)
+
+	reason, err := d.Continue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reason != StopBreakpoint || d.CPU.PC != 0x3002 {
+		t.Errorf("stopped with %d at 0x%04x expected %d at 0x3002", reason, d.CPU.PC, StopBreakpoint)
+	}
+
+	reason, _ = d.Continue()
+	if reason != StopHalted || d.CPU.Reg[0] != 3 {
+		t.Errorf("stopped with %d and R0 %d expected %d and 3", reason, d.CPU.Reg[0], StopHalted)
+	}
+}
+
+func TestDebuggerNextAndFinish(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0x4802 // JSR x3003
+	m[0x3001] = 0x1021 // ADD R0, R0, #1
+	m[0x3002] = 0xF025 // HALT
+	m[0x3003] = 0x1261 // ADD R1, R1, #1
+	m[0x3004] = 0x1261 // ADD R1, R1, #1
+	m[0x3005] = 0xC1C0 // RET
+
+	d := NewDebugger(initCPU(m))
+	if reason, _ := d.Next(); reason != StopStep || d.CPU.PC != 0x3001 || d.CPU.Reg[1] != 2 {
+		t.Errorf("next stopped with %d at 0x%04x, R1 %d", reason, d.CPU.PC, d.CPU.Reg[1])
+	}
+
+	d.CPU.Reset()
+	d.Step()
+	if d.CPU.PC != 0x3003 {
+		t.Fatalf("step stopped at 0x%04x expected 0x3003", d.CPU.PC)
+	}
+	if reason, _ := d.Finish(); reason != StopStep || d.CPU.PC != 0x3001 {
+		t.Errorf("finish stopped with %d at 0x%04x expected 0x3001", reason, d.CPU.PC)
+	}
+}
+
+func TestDebuggerFinishTrap(t *testing.T) {
+	names := map[Edition]string{SecondEdition: "2nd edition", ThirdEdition: "3rd edition"}
+	for _, edition := range []Edition{SecondEdition, ThirdEdition} {
+		m := [65536]uint16{}
+		m[0x0026] = 0x0200 // service routine for TRAP x26
+		m[0x0200] = 0x3E04 // ST R7, x0205
+		m[0x0201] = 0x4802 // JSR x0204
+		m[0x0202] = 0x2E02 // LD R7, x0205
+		m[0x0203] = 0xC1C0 // RET
+		if edition == ThirdEdition {
+			m[0x0203] = 0x8000 // RTI
+		}
+		m[0x0204] = 0xC1C0 // RET
+		m[0x3000] = 0x480F // JSR x3010
+		m[0x3001] = 0x1021 // ADD R0, R0, #1
+		m[0x3010] = 0x3E03 // ST R7, x3014
+		m[0x3011] = 0xF026 // TRAP x26
+		m[0x3012] = 0x2E01 // LD R7, x3014
+		m[0x3013] = 0xC1C0 // RET
+
+		cpu := initCPU(m)
+		cpu.osLoaded = true
+		cpu.OSEdition = edition
+		d := NewDebugger(cpu)
+
+		// the subroutine calls a trap whose service routine calls a subroutine
+		d.Step()
+		if reason, _ := d.Finish(); reason != StopStep || cpu.PC != 0x3001 {
+			t.Errorf("%s: finish stopped with %d at 0x%04x expected 0x3001", names[edition], reason, cpu.PC)
+		}
+
+		// finishing inside the service routine returns from the trap
+		cpu.PC = 0x3011
+		d.Step()
+		d.Step()
+		if reason, _ := d.Finish(); reason != StopStep || cpu.PC != 0x3012 {
+			t.Errorf("%s: finish stopped with %d at 0x%04x expected 0x3012", names[edition], reason, cpu.PC)
+		}
+	}
+}
+
+func TestReadSymbols(t *testing.T) {
+	sym := `// Symbol table
+// Scope level 0:
+//	Symbol Name       Page Address
+//	----------------  ------------
+//	LOOP              3002
+//	DONE              300A
+`
+	symbols, err := ReadSymbols(strings.NewReader(sym))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(symbols) != 2 || symbols["LOOP"] != 0x3002 || symbols["DONE"] != 0x300A {
+		t.Errorf("symbols %v expected LOOP 0x3002 and DONE 0x300A", symbols)
+	}
+	if label, ok := symbols.Label(0x300A); !ok || label != "DONE" {
+		t.Errorf("label %q expected DONE", label)
+	}
+}
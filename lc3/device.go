@@ -0,0 +1,71 @@
+package lc3
+
+// Device is a peripheral mapped into the address space of the CPU. Reads and
+// writes to the addresses claimed by a device are passed to it instead of
+// going to memory.
+type Device interface {
+	// Read returns the value of the device register at address.
+	Read(address uint16) (uint16, error)
+
+	// Write sets the device register at address to value.
+	Write(address uint16, value uint16) error
+}
+
+// Ticker is implemented by devices that update their state as the CPU runs.
+// Tick is called after every instruction.
+type Ticker interface {
+	Tick() error
+}
+
+// Interrupter is implemented by devices that can request interrupts. It is
+// polled before every instruction and returns the interrupt the device is
+// requesting, if any.
+type Interrupter interface {
+	Interrupt() (Interrupt, bool)
+}
+
+// deviceMapping is a range of addresses claimed by a device.
+type deviceMapping struct {
+	start  uint16
+	end    uint16
+	device Device
+}
+
+// Attach maps a device into the address space of the CPU, so that it handles
+// every access to the addresses from start to end inclusive. The range may
+// not overlap a device that is already attached.
+func (c *CPU) Attach(start, end uint16, device Device) error {
+	if end < start {
+		return ErrBadAddress
+	}
+	for _, m := range c.devices {
+		if start <= m.end && end >= m.start {
+			return ErrDeviceOverlap
+		}
+	}
+	c.devices = append(c.devices, deviceMapping{start: start, end: end, device: device})
+	return nil
+}
+
+// deviceAt returns the device mapped at address, or nil if the address is
+// backed by memory.
+func (c *CPU) deviceAt(address uint16) Device {
+	for i := range c.devices {
+		if address >= c.devices[i].start && address <= c.devices[i].end {
+			return c.devices[i].device
+		}
+	}
+	return nil
+}
+
+// tickDevices lets every attached device update its state.
+func (c *CPU) tickDevices() error {
+	for _, m := range c.devices {
+		if t, ok := m.device.(Ticker); ok {
+			if err := t.Tick(); err != nil {
+				return c.fault(err)
+			}
+		}
+	}
+	return nil
+}
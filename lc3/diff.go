@@ -0,0 +1,166 @@
+package lc3
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Divergence describes the first point at which a program's execution differs
+// from a reference trace.
+type Divergence struct {
+	Index    int          // index of the reference record that differs
+	Reason   string       // what differs
+	Expected *TraceRecord // the reference record, nil if the trace ended
+	Actual   *TraceRecord // the record of the instruction executed, nil if none was
+	State    string       // the CPU state after the instruction, from DumpState
+}
+
+func (d *Divergence) Error() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "execution diverges from the reference trace at instruction %d: %s\n", d.Index, d.Reason)
+	if d.Expected != nil {
+		fmt.Fprintf(b, "expected: %s\n", formatTraceRecord(d.Expected))
+	}
+	if d.Actual != nil {
+		fmt.Fprintf(b, "actual:   %s\n", formatTraceRecord(d.Actual))
+	}
+	b.WriteString(d.State)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// recordingTracer keeps the last record it was given.
+type recordingTracer struct {
+	last *TraceRecord
+}
+
+func (t *recordingTracer) Trace(rec *TraceRecord) error {
+	t.last = rec
+	return nil
+}
+
+// CompareTrace executes the program loaded into the CPU one instruction at a
+// time, comparing the effects of each instruction with the next record of a
+// reference trace, read by ReadTrace or ReadLC3SimTrace. It compares the PC,
+// the instruction, the registers, the memory written and the PSR, and returns
+// a *Divergence describing the first difference. The records' reads and cycle
+// counts are not compared, since simulators differ in how they count them, and
+// records read from register dumps are compared without memory writes and by
+// their condition codes alone. It returns nil once every reference record has
+// been matched.
+func (c *CPU) CompareTrace(reference []TraceRecord) error {
+	tracer := &recordingTracer{}
+	saved := c.Tracer
+	c.Tracer = tracer
+	defer func() { c.Tracer = saved }()
+
+	c.start()
+	defer func() {
+		if c.State() == RunStateRunning {
+			c.setState(RunStateStopped)
+		}
+	}()
+
+	// the reference's register writes are applied to a copy of the registers,
+	// so that writes of unchanged values do not need to be listed
+	regs := c.Reg
+	for i := range reference {
+		expected := &reference[i]
+		diverge := func(actual *TraceRecord, format string, args ...interface{}) error {
+			return &Divergence{Index: i, Reason: fmt.Sprintf(format, args...), Expected: expected, Actual: actual, State: c.DumpState()}
+		}
+
+		if c.State() == RunStateHalted {
+			return diverge(nil, "the program halted")
+		}
+
+		// step until an instruction completes, as traps waiting for input are
+		// retried
+		tracer.last = nil
+		for tracer.last == nil {
+			if err := c.Step(); err != nil {
+				return diverge(nil, "%v", err)
+			}
+			if c.State() == RunStateStopped {
+				return diverge(nil, "the program was stopped")
+			}
+		}
+		actual := tracer.last
+
+		for _, w := range expected.Regs {
+			if w.Reg < 8 {
+				regs[w.Reg] = w.Value
+			}
+		}
+
+		switch {
+		case actual.PC != expected.PC:
+			return diverge(actual, "PC is x%04X, expected x%04X", actual.PC, expected.PC)
+		case actual.Instr != expected.Instr:
+			return diverge(actual, "instruction is x%04X, expected x%04X", actual.Instr, expected.Instr)
+		case c.Reg != regs:
+			for r := range regs {
+				if c.Reg[r] != regs[r] {
+					return diverge(actual, "R%d is x%04X, expected x%04X", r, c.Reg[r], regs[r])
+				}
+			}
+		case expected.registersOnly:
+			if actual.CC() != expected.CC() {
+				return diverge(actual, "condition codes are %s, expected %s", actual.CC(), expected.CC())
+			}
+		case !sameAccesses(actual.Writes, expected.Writes):
+			return diverge(actual, "memory writes are %s, expected %s", formatAccesses(actual.Writes), formatAccesses(expected.Writes))
+		case actual.PSR != expected.PSR:
+			return diverge(actual, "PSR is x%04X, expected x%04X", actual.PSR, expected.PSR)
+		}
+	}
+	return nil
+}
+
+// DumpState returns a description of the registers, condition codes and the
+// instruction at the PC.
+func (c *CPU) DumpState() string {
+	b := &strings.Builder{}
+	for row := 0; row < 8; row += 4 {
+		regs := make([]string, 4)
+		for i := range regs {
+			regs[i] = fmt.Sprintf("R%d: x%04X", row+i, c.Reg[row+i])
+		}
+		fmt.Fprintln(b, strings.Join(regs, "  "))
+	}
+	cc := (&TraceRecord{PSR: c.PSR()}).CC()
+	fmt.Fprintf(b, "PC: x%04X  PSR: x%04X  CC: %s  Cycles: %d\n", c.PC, c.PSR(), cc, c.Cycles)
+	fmt.Fprintf(b, "Next: %s\n", ListingLine(c.PC, c.Memory[c.PC], nil))
+	return b.String()
+}
+
+func sameAccesses(a, b []MemoryTrace) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatAccesses(accesses []MemoryTrace) string {
+	if len(accesses) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(accesses))
+	for i, m := range accesses {
+		parts[i] = fmt.Sprintf("x%04X=x%04X", m.Addr, m.Value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatTraceRecord(rec *TraceRecord) string {
+	regs := make([]string, len(rec.Regs))
+	for i, w := range rec.Regs {
+		regs[i] = fmt.Sprintf("R%d=x%04X", w.Reg, w.Value)
+	}
+	return fmt.Sprintf("x%04X %04X %-16s regs [%s] writes [%s] PSR x%04X",
+		rec.PC, rec.Instr, Disassemble(rec.PC, rec.Instr), strings.Join(regs, " "), formatAccesses(rec.Writes), rec.PSR)
+}
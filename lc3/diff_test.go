@@ -0,0 +1,125 @@
+package lc3
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// traceCollector keeps every record it is given.
+type traceCollector struct {
+	records []TraceRecord
+}
+
+func (t *traceCollector) Trace(rec *TraceRecord) error {
+	t.records = append(t.records, *rec)
+	return nil
+}
+
+// loadProgram assembles a test program from testdata into a new CPU.
+func loadProgram(t *testing.T, name string) *CPU {
+	p, err := AssembleFile(filepath.Join("testdata", name+".asm"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cpu := NewCPU()
+	cpu.Load(p)
+	cpu.Reset()
+	return cpu
+}
+
+// selfTrace runs a test program to completion, returning a fresh CPU loaded
+// with the program and the program's trace. Since the trace comes from this
+// VM it tests CompareTrace, not the VM.
+func selfTrace(t *testing.T, name string) (*CPU, []TraceRecord) {
+	collector := &traceCollector{}
+	cpu := loadProgram(t, name)
+	cpu.Tracer = collector
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return loadProgram(t, name), collector.records
+}
+
+// TestCompareTrace compares the VM with each recording of lc3sim in testdata,
+// named after the program it ran. A recording starts with a comment naming
+// the lc3sim version and the command that produced it.
+func TestCompareTrace(t *testing.T) {
+	recordings, _ := filepath.Glob(filepath.Join("testdata", "*.lc3sim"))
+	if len(recordings) == 0 {
+		t.Skip("no lc3sim recordings in testdata")
+	}
+	for _, recording := range recordings {
+		name := strings.TrimSuffix(filepath.Base(recording), ".lc3sim")
+		t.Run(name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(recording)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.HasPrefix(data, []byte("# lc3sim ")) {
+				t.Fatalf("%s does not start with the lc3sim version and command that recorded it", recording)
+			}
+			reference, err := ReadLC3SimTrace(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := loadProgram(t, name).CompareTrace(reference); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCompareTraceDivergence(t *testing.T) {
+	cpu, reference := selfTrace(t, "signext")
+	if err := cpu.CompareTrace(reference); err != nil {
+		t.Fatalf("the program diverges from its own trace: %v", err)
+	}
+
+	cpu, reference = selfTrace(t, "signext")
+	reference[4].Regs[0].Value = 0x0800 // LDR R3, R2, #-1
+
+	err := cpu.CompareTrace(reference)
+	var d *Divergence
+	if !errors.As(err, &d) {
+		t.Fatalf("error %v expected a divergence", err)
+	}
+	if d.Index != 4 || d.Reason != "R3 is x8000, expected x0800" {
+		t.Errorf("divergence at %d: %s, expected at 4: R3 is x8000, expected x0800", d.Index, d.Reason)
+	}
+	if !strings.Contains(d.Error(), "R3: x8000") || !strings.Contains(d.Error(), "PC: x3005") {
+		t.Errorf("divergence does not include the CPU state:\n%v", d)
+	}
+}
+
+func TestCompareTraceConditionCodes(t *testing.T) {
+	// register dumps in lc3sim's format, with the wrong condition codes after
+	// LEA R2, DATA
+	reference, err := ReadLC3SimTrace(strings.NewReader(`
+PC=x3000 IR=x0000 PSR=x0002 (ZERO)
+R0=x0000 R1=x0000 R2=x0000 R3=x0000 R4=x0000 R5=x0000 R6=x3000 R7=x0000
+PC=x3001 IR=x5020 PSR=x0002 (ZERO)
+R0=x0000 R1=x0000 R2=x0000 R3=x0000 R4=x0000 R5=x0000 R6=x3000 R7=x0000
+PC=x3002 IR=x1030 PSR=x0004 (NEGATIVE)
+R0=xFFF0 R1=x0000 R2=x0000 R3=x0000 R4=x0000 R5=x0000 R6=x3000 R7=x0000
+PC=x3003 IR=x122F PSR=x0004 (NEGATIVE)
+R0=xFFF0 R1=xFFFF R2=x0000 R3=x0000 R4=x0000 R5=x0000 R6=x3000 R7=x0000
+PC=x3004 IR=xE40D PSR=x0004 (NEGATIVE)
+R0=xFFF0 R1=xFFFF R2=x3011 R3=x0000 R4=x0000 R5=x0000 R6=x3000 R7=x0000
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = loadProgram(t, "signext").CompareTrace(reference)
+	var d *Divergence
+	if !errors.As(err, &d) {
+		t.Fatalf("error %v expected a divergence", err)
+	}
+	if d.Index != 3 || d.Reason != "condition codes are P, expected N" {
+		t.Errorf("divergence at %d: %s, expected at 3: condition codes are P, expected N", d.Index, d.Reason)
+	}
+}
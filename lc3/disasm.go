@@ -0,0 +1,145 @@
+package lc3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// opNames are the mnemonics of the opcodes that share an operand format.
+var opNames = map[uint16]string{
+	OpADD: "ADD", OpAND: "AND",
+	OpLD: "LD", OpLDI: "LDI", OpLEA: "LEA", OpST: "ST", OpSTI: "STI",
+	OpLDR: "LDR", OpSTR: "STR",
+}
+
+// trapNames are the aliases of the trap routines.
+var trapNames = map[uint16]string{
+	TrapGETC:  "GETC",
+	TrapOUT:   "OUT",
+	TrapPUTS:  "PUTS",
+	TrapIN:    "IN",
+	TrapPUTSP: "PUTSP",
+	TrapHALT:  "HALT",
+}
+
+// Disassemble returns the assembly language form of the instruction instr
+// stored at address. PC-relative operands are shown as the address they
+// refer to. Words that are not valid instructions, including those with
+// reserved bits set, are shown as .FILL directives.
+func Disassemble(address uint16, instr uint16) string {
+	return DisassembleSymbols(address, instr, nil)
+}
+
+// DisassembleSymbols is like Disassemble, but shows PC-relative operands as
+// labels from symbols where possible.
+func DisassembleSymbols(address uint16, instr uint16, symbols SymbolTable) string {
+	pc := address + 1
+	target := func(offset uint16) string {
+		if label, ok := symbols.Label(pc + offset); ok {
+			return label
+		}
+		return fmt.Sprintf("x%04X", pc+offset)
+	}
+
+	dr := extract1C(instr, 11, 9)
+	sr1 := extract1C(instr, 8, 6)
+	fill := fmt.Sprintf(".FILL x%04X", instr)
+
+	switch instr >> 12 {
+	case OpBR:
+		var flags string
+		if extract1C(instr, 11, 11) == 1 {
+			flags += "n"
+		}
+		if extract1C(instr, 10, 10) == 1 {
+			flags += "z"
+		}
+		if extract1C(instr, 9, 9) == 1 {
+			flags += "p"
+		}
+		if flags == "" {
+			// a branch that is never taken does nothing, but only x0000
+			// is written as NOP. Other such words are usually data, such
+			// as the characters of a string.
+			if instr == 0 {
+				return "NOP"
+			}
+			return fill
+		}
+		return fmt.Sprintf("BR%s %s", flags, target(extract2C(instr, 8, 0)))
+	case OpADD, OpAND:
+		if extract1C(instr, 5, 5) == 1 {
+			return fmt.Sprintf("%s R%d, R%d, #%d", opNames[instr>>12], dr, sr1, int16(extract2C(instr, 4, 0)))
+		}
+		if extract1C(instr, 4, 3) != 0 {
+			return fill
+		}
+		return fmt.Sprintf("%s R%d, R%d, R%d", opNames[instr>>12], dr, sr1, extract1C(instr, 2, 0))
+	case OpNOT:
+		if extract1C(instr, 5, 0) != 0x3F {
+			return fill
+		}
+		return fmt.Sprintf("NOT R%d, R%d", dr, sr1)
+	case OpLD, OpLDI, OpLEA, OpST, OpSTI:
+		return fmt.Sprintf("%s R%d, %s", opNames[instr>>12], dr, target(extract2C(instr, 8, 0)))
+	case OpLDR, OpSTR:
+		return fmt.Sprintf("%s R%d, R%d, #%d", opNames[instr>>12], dr, sr1, int16(extract2C(instr, 5, 0)))
+	case OpJSR:
+		if extract1C(instr, 11, 11) == 1 {
+			return fmt.Sprintf("JSR %s", target(extract2C(instr, 10, 0)))
+		}
+		if extract1C(instr, 10, 9) != 0 || extract1C(instr, 5, 0) != 0 {
+			return fill
+		}
+		return fmt.Sprintf("JSRR R%d", sr1)
+	case OpJMP:
+		if dr != 0 || extract1C(instr, 5, 0) != 0 {
+			return fill
+		}
+		if sr1 == 7 {
+			return "RET"
+		}
+		return fmt.Sprintf("JMP R%d", sr1)
+	case OpRTI:
+		if extract1C(instr, 11, 0) != 0 {
+			return fill
+		}
+		return "RTI"
+	case OpTRAP:
+		if extract1C(instr, 11, 8) != 0 {
+			return fill
+		}
+		if name, ok := trapNames[instr&0xFF]; ok {
+			return name
+		}
+		return fmt.Sprintf("TRAP x%02X", instr&0xFF)
+	}
+	return fill
+}
+
+// ListingLine formats the instruction instr stored at address as a line of
+// a listing, showing the address, the raw word, its label and its
+// disassembly.
+func ListingLine(address uint16, instr uint16, symbols SymbolTable) string {
+	label, _ := symbols.Label(address)
+	return fmt.Sprintf("x%04X  %04X  %-12s %s", address, instr, label, DisassembleSymbols(address, instr, symbols))
+}
+
+// WriteListing writes a listing of words, which are stored in memory starting
+// at origin. A memory range can be listed by passing a slice of a CPU's
+// Memory.
+func WriteListing(w io.Writer, origin uint16, words []uint16, symbols SymbolTable) error {
+	b := bufio.NewWriter(w)
+	for i, word := range words {
+		if _, err := fmt.Fprintln(b, ListingLine(origin+uint16(i), word, symbols)); err != nil {
+			return err
+		}
+	}
+	return b.Flush()
+}
+
+// isReturn reports whether instr is a RET (JMP R7).
+func isReturn(instr uint16) bool {
+	return instr>>12 == OpJMP && extract1C(instr, 8, 6) == 7
+}
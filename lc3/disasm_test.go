@@ -0,0 +1,66 @@
+package lc3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		instr uint16
+		want  string
+	}{
+		{0x0E01, "BRnzp x3002"},
+		{0x0000, "NOP"},
+		{0x0048, ".FILL x0048"},
+		{0x01FF, ".FILL x01FF"},
+		{0x1021, "ADD R0, R0, #1"},
+		{0x5242, "AND R1, R1, R2"},
+		{0x2DFF, "LD R6, x3000"},
+		{0x6042, "LDR R0, R1, #2"},
+		{0x4802, "JSR x3003"},
+		{0xC1C0, "RET"},
+		{0xF025, "HALT"},
+		{0xF0FF, "TRAP xFF"},
+		{0xD000, ".FILL xD000"},
+		{0x907F, "NOT R0, R1"},
+		{0x9040, ".FILL x9040"},
+		{0xC080, "JMP R2"},
+		{0xC1C1, ".FILL xC1C1"},
+		{0xCE00, ".FILL xCE00"},
+		{0x8000, "RTI"},
+		{0x8001, ".FILL x8001"},
+		{0x4080, "JSRR R2"},
+		{0x4280, ".FILL x4280"},
+		{0x1048, ".FILL x1048"},
+		{0xF125, ".FILL xF125"},
+	}
+	for _, tt := range tests {
+		if got := Disassemble(0x3000, tt.instr); got != tt.want {
+			t.Errorf("Disassemble(0x%04x) %q expected %q", tt.instr, got, tt.want)
+		}
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	obj := []byte{0x30, 0x00, 0x04, 0x01, 0xF0, 0x25, 0x0F, 0xFE}
+	p, err := ReadObj(bytes.NewReader(obj))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Origin != 0x3000 || len(p.Words) != 3 {
+		t.Fatalf("origin 0x%04x and %d words expected 0x3000 and 3", p.Origin, len(p.Words))
+	}
+
+	var out bytes.Buffer
+	symbols := SymbolTable{"LOOP": 0x3000, "DONE": 0x3002}
+	if err := WriteListing(&out, p.Origin, p.Words, symbols); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "x3000  0401  LOOP         BRz DONE\n" +
+		"x3001  F025               HALT\n" +
+		"x3002  0FFE  DONE         BRnzp x3001\n"
+	if out.String() != want {
+		t.Errorf("listing:\n%s\nexpected:\n%s", out.String(), want)
+	}
+}
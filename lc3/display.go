@@ -0,0 +1,62 @@
+package lc3
+
+// Display status register bits
+const (
+	dsrReady uint16 = 0x8000 // DSR[15], set when the display can accept a character
+)
+
+// display is the device behind the display status and data registers.
+type display struct {
+	cpu    *CPU
+	status uint16 // DSR
+	data   uint16 // DDR
+	busy   int    // instructions until DSR is ready
+}
+
+func (d *display) Read(address uint16) (uint16, error) {
+	switch address {
+	case MemRegDSR:
+		return d.status, nil
+	case MemRegDDR:
+		return d.data, nil
+	}
+	return 0, nil
+}
+
+// Write writes the character in the low byte of value to the console when
+// it is written to DDR, and marks the display busy. The ready bit of DSR is
+// set again once the writing instruction and DisplayDelay further
+// instructions have executed.
+func (d *display) Write(address uint16, value uint16) error {
+	if address != MemRegDDR {
+		return nil
+	}
+
+	d.data = value
+	if err := d.cpu.writeChar(value); err != nil {
+		return err
+	}
+
+	d.status &^= dsrReady
+	d.busy = d.cpu.DisplayDelay + 1
+	return nil
+}
+
+// Tick counts down the time the display is busy for after a write, setting
+// the ready bit of DSR once it is done.
+func (d *display) Tick() error {
+	if d.busy == 0 {
+		return nil
+	}
+	d.busy--
+	if d.busy == 0 {
+		d.status |= dsrReady
+	}
+	return nil
+}
+
+// reset makes the display ready to accept a character.
+func (d *display) reset() {
+	d.status = dsrReady
+	d.busy = 0
+}
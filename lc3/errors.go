@@ -0,0 +1,49 @@
+package lc3
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors reported by the CPU. Faults that happen while a program is running
+// are wrapped in a TraceableError.
+var (
+	ErrNoProgram       = errors.New("no program loaded or memory device attached")
+	ErrBadAddress      = errors.New("illegal effective address")
+	ErrBadOpcode       = errors.New("illegal operation code")
+	ErrBadOpSize       = errors.New("illegal operand size")
+	ErrNotImplemented  = errors.New("operation code not implemented")
+	ErrNoInput         = errors.New("keyboard input closed while waiting for a key")
+	ErrPrivilege       = errors.New("privilege mode violation")
+	ErrAccessViolation = errors.New("access control violation")
+	ErrBadTrap         = errors.New("trap code not implemented")
+	ErrNoHandler       = errors.New("no service routine in the interrupt vector table")
+	ErrDeviceOverlap   = errors.New("device address range overlaps an attached device")
+	ErrNoHistory       = errors.New("instruction is not in the execution history")
+	ErrBadSnapshot     = errors.New("not an LC-3 snapshot")
+	ErrReplayDiverged  = errors.New("replayed key was not read at the recorded instruction")
+)
+
+// TraceableError is a fault raised while executing a program. It records the
+// address and encoding of the instruction that caused it. The PC is left on
+// that instruction, so execution can be resumed once the cause has been dealt
+// with.
+type TraceableError struct {
+	Addr   uint32
+	Opcode uint16
+	Err    error
+}
+
+func newTraceableError(addr uint32, op uint16, err error) error {
+	return &TraceableError{addr, op, err}
+}
+
+func (e *TraceableError) Error() string {
+	return fmt.Sprintf("%s (Op: 0x%04X, PC: 0x%X)", e.Err.Error(), e.Opcode, e.Addr)
+}
+
+// Unwrap returns the underlying error, so that errors.Is can be used to test
+// for the cause of a fault.
+func (e *TraceableError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,491 @@
+package lc3
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gdbTargetXML describes the LC-3 registers to GDB. The registers are sent in
+// this order by the g and G packets. The PC holds a byte address, which needs
+// 17 bits, so it is 32 bits wide.
+const gdbTargetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.gnu.gdb.lc3.core">
+    <reg name="r0" bitsize="16" type="int16" regnum="0"/>
+    <reg name="r1" bitsize="16" type="int16"/>
+    <reg name="r2" bitsize="16" type="int16"/>
+    <reg name="r3" bitsize="16" type="int16"/>
+    <reg name="r4" bitsize="16" type="int16"/>
+    <reg name="r5" bitsize="16" type="int16"/>
+    <reg name="r6" bitsize="16" type="data_ptr"/>
+    <reg name="r7" bitsize="16" type="code_ptr"/>
+    <reg name="pc" bitsize="32" type="code_ptr"/>
+    <reg name="psr" bitsize="16" type="uint16"/>
+  </feature>
+</target>
+`
+
+// Register numbers used by GDB.
+const (
+	gdbRegPC    = 8
+	gdbRegPSR   = 9
+	gdbRegCount = 10
+)
+
+// Signals reported to GDB in stop replies.
+const (
+	gdbSigInt  = 2
+	gdbSigIll  = 4
+	gdbSigTrap = 5
+	gdbSigSegv = 11
+)
+
+// gdbPacketSize is the largest packet the server accepts, advertised in
+// reply to qSupported.
+const gdbPacketSize = 0x1000
+
+// gdbInterrupt is passed from the packet reader when GDB sends a break.
+const gdbInterrupt = "\x03"
+
+// gdbServer serves a single GDB remote serial protocol session.
+type gdbServer struct {
+	debugger *Debugger
+	r        *bufio.Reader
+	w        io.Writer
+	mu       sync.Mutex // guards w
+	packets  chan string
+	err      error // the error that closed packets
+	lastStop string
+}
+
+// ServeGDB debugs the CPU with a GDB client connected over rw, using the GDB
+// remote serial protocol. It returns when the client detaches or kills the
+// program, or the connection is closed.
+//
+// GDB addresses memory in bytes, so LC-3 word address A is exposed as byte
+// address 2*A, holding the high byte of the word, and 2*A+1. The PC is
+// reported as a byte address to match, in a 32-bit register. Registers are
+// sent big-endian.
+func ServeGDB(d *Debugger, rw io.ReadWriter) error {
+	s := &gdbServer{
+		debugger: d,
+		r:        bufio.NewReader(rw),
+		w:        rw,
+		packets:  make(chan string),
+		lastStop: fmt.Sprintf("S%02x", gdbSigTrap),
+	}
+	go s.readPackets()
+
+	for packet := range s.packets {
+		if packet == gdbInterrupt {
+			// the program is not running
+			continue
+		}
+		reply, done := s.handle(packet)
+		if packet == "k" {
+			// kill has no reply
+			return nil
+		}
+		if err := s.send(reply); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// readPackets reads packets from the client, acknowledges them and passes
+// them to the server.
+func (s *gdbServer) readPackets() {
+	defer close(s.packets)
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		switch b {
+		case 0x03:
+			s.packets <- gdbInterrupt
+		case '$':
+			data, err := s.r.ReadString('#')
+			if err != nil {
+				s.err = err
+				return
+			}
+			data = data[:len(data)-1]
+
+			sum := make([]byte, 2)
+			if _, err := io.ReadFull(s.r, sum); err != nil {
+				s.err = err
+				return
+			}
+			if checksum, err := strconv.ParseUint(string(sum), 16, 8); err != nil || byte(checksum) != gdbChecksum(data) {
+				s.write("-")
+				continue
+			}
+			s.write("+")
+			s.packets <- gdbUnescape(data)
+		}
+	}
+}
+
+// handle processes a packet and returns the reply. done is true when the
+// session is over.
+func (s *gdbServer) handle(packet string) (reply string, done bool) {
+	cpu := s.debugger.CPU
+	if packet == "" {
+		return "", false
+	}
+
+	switch packet[0] {
+	case '?':
+		return s.lastStop, false
+	case 'g':
+		var regs string
+		for i := 0; i < gdbRegCount; i++ {
+			regs += s.formatRegister(i)
+		}
+		return regs, false
+	case 'G':
+		data := packet[1:]
+		for i := 0; i < gdbRegCount; i++ {
+			digits := gdbRegisterDigits(i)
+			if len(data) < digits {
+				break
+			}
+			value, err := strconv.ParseUint(data[:digits], 16, 32)
+			if err != nil {
+				return "E01", false
+			}
+			s.setRegister(i, uint32(value))
+			data = data[digits:]
+		}
+		return "OK", false
+	case 'p':
+		n, err := strconv.ParseUint(packet[1:], 16, 8)
+		if err != nil || n >= gdbRegCount {
+			return "E01", false
+		}
+		return s.formatRegister(int(n)), false
+	case 'P':
+		parts := strings.SplitN(packet[1:], "=", 2)
+		if len(parts) != 2 {
+			return "E01", false
+		}
+		n, err := strconv.ParseUint(parts[0], 16, 8)
+		if err != nil || n >= gdbRegCount {
+			return "E01", false
+		}
+		value, err := strconv.ParseUint(parts[1], 16, gdbRegisterDigits(int(n))*4)
+		if err != nil {
+			return "E01", false
+		}
+		s.setRegister(int(n), uint32(value))
+		return "OK", false
+	case 'm':
+		address, length, err := gdbRange(packet[1:])
+		if err != nil || length > gdbPacketSize/2 {
+			return "E01", false
+		}
+		data := make([]byte, length)
+		for i := range data {
+			word := cpu.Memory[uint16((address+uint32(i))/2)]
+			if (address+uint32(i))%2 == 0 {
+				data[i] = byte(word >> 8)
+			} else {
+				data[i] = byte(word)
+			}
+		}
+		return hex.EncodeToString(data), false
+	case 'M':
+		parts := strings.SplitN(packet[1:], ":", 2)
+		if len(parts) != 2 {
+			return "E01", false
+		}
+		address, length, err := gdbRange(parts[0])
+		if err != nil {
+			return "E01", false
+		}
+		data, err := hex.DecodeString(parts[1])
+		if err != nil || uint32(len(data)) != length {
+			return "E01", false
+		}
+		cpu.DiscardFuture()
+		for i, b := range data {
+			word := &cpu.Memory[uint16((address+uint32(i))/2)]
+			if (address+uint32(i))%2 == 0 {
+				*word = *word&0x00FF | uint16(b)<<8
+			} else {
+				*word = *word&0xFF00 | uint16(b)
+			}
+		}
+		return "OK", false
+	case 'Z', 'z':
+		parts := strings.Split(packet[1:], ",")
+		if len(parts) < 2 || (parts[0] != "0" && parts[0] != "1") {
+			// only software and hardware breakpoints are supported
+			return "", false
+		}
+		address, err := strconv.ParseUint(parts[1], 16, 32)
+		if err != nil {
+			return "E01", false
+		}
+		if packet[0] == 'Z' {
+			s.debugger.SetBreakpoint(uint16(address / 2))
+		} else {
+			s.debugger.ClearBreakpoint(uint16(address / 2))
+		}
+		return "OK", false
+	case 's', 'c':
+		if len(packet) > 1 {
+			address, err := strconv.ParseUint(packet[1:], 16, 32)
+			if err != nil {
+				return "E01", false
+			}
+			cpu.DiscardFuture()
+			cpu.PC = uint16(address / 2)
+		}
+		if packet[0] == 's' {
+			s.lastStop = s.stopReply(s.debugger.Step())
+		} else {
+			s.lastStop = s.resume(s.debugger.Continue)
+		}
+		return s.lastStop, false
+	case 'b':
+		// reverse execution
+		switch packet {
+		case "bs":
+			s.lastStop = s.stopReply(s.debugger.StepBack())
+		case "bc":
+			s.lastStop = s.resume(s.debugger.ReverseContinue)
+		default:
+			return "", false
+		}
+		return s.lastStop, false
+	case 'H', 'T':
+		// there is only one thread
+		return "OK", false
+	case 'D', 'k':
+		return "OK", true
+	case 'q':
+		return s.query(packet), false
+	}
+	return "", false
+}
+
+// query answers the general query packets.
+func (s *gdbServer) query(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		features := fmt.Sprintf("PacketSize=%x;qXfer:features:read+;swbreak+;hwbreak+", gdbPacketSize)
+		if s.debugger.CPU.History != nil {
+			features += ";ReverseStep+;ReverseContinue+"
+		}
+		return features
+	case packet == "qAttached":
+		return "1"
+	case packet == "qC":
+		return "QC1"
+	case packet == "qfThreadInfo":
+		return "m1"
+	case packet == "qsThreadInfo":
+		return "l"
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		address, length, err := gdbRange(strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"))
+		if err != nil {
+			return "E01"
+		}
+		if address >= uint32(len(gdbTargetXML)) {
+			return "l"
+		}
+		end := address + length
+		if end >= uint32(len(gdbTargetXML)) {
+			return "l" + gdbTargetXML[address:]
+		}
+		return "m" + gdbTargetXML[address:end]
+	}
+	return ""
+}
+
+// resume continues execution with run until the program stops, or the
+// client sends a break.
+func (s *gdbServer) resume(run func() (StopReason, error)) string {
+	type result struct {
+		reason StopReason
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reason, err := run()
+		done <- result{reason, err}
+	}()
+
+	interrupted := false
+	packets := s.packets
+	for {
+		select {
+		case r := <-done:
+			if interrupted && r.reason == StopInterrupted && r.err == nil {
+				return fmt.Sprintf("S%02x", gdbSigInt)
+			}
+			return s.stopReply(r.reason, r.err)
+		case packet, ok := <-packets:
+			if !ok {
+				// the connection was closed
+				packets = nil
+				s.debugger.CPU.Stop()
+				continue
+			}
+			if packet == gdbInterrupt {
+				interrupted = true
+				s.debugger.CPU.Stop()
+			}
+		}
+	}
+}
+
+// stopReply builds the reply that tells GDB why the program stopped.
+func (s *gdbServer) stopReply(reason StopReason, err error) string {
+	switch {
+	case err != nil:
+		var signal int
+		switch {
+		case errors.Is(err, ErrBadOpcode), errors.Is(err, ErrBadTrap):
+			signal = gdbSigIll
+		case errors.Is(err, ErrBadAddress), errors.Is(err, ErrAccessViolation):
+			signal = gdbSigSegv
+		default:
+			signal = gdbSigTrap
+		}
+		return fmt.Sprintf("S%02x", signal)
+	case reason == StopHalted:
+		return "W00"
+	case reason == StopInterrupted:
+		return fmt.Sprintf("S%02x", gdbSigInt)
+	case reason == StopBreakpoint:
+		return fmt.Sprintf("T%02xswbreak:;", gdbSigTrap)
+	case reason == StopHistoryStart:
+		return fmt.Sprintf("T%02xreplaylog:begin;", gdbSigTrap)
+	}
+	return fmt.Sprintf("S%02x", gdbSigTrap)
+}
+
+// gdbRegisterDigits returns the number of hex digits GDB register n is sent
+// as.
+func gdbRegisterDigits(n int) int {
+	if n == gdbRegPC {
+		return 8
+	}
+	return 4
+}
+
+// register returns the value of GDB register n.
+func (s *gdbServer) register(n int) uint32 {
+	cpu := s.debugger.CPU
+	switch n {
+	case gdbRegPC:
+		return uint32(cpu.PC) * 2
+	case gdbRegPSR:
+		return uint32(cpu.PSR())
+	}
+	return uint32(cpu.Reg[n])
+}
+
+// formatRegister returns GDB register n encoded for a packet.
+func (s *gdbServer) formatRegister(n int) string {
+	return fmt.Sprintf("%0*x", gdbRegisterDigits(n), s.register(n))
+}
+
+// setRegister sets GDB register n.
+func (s *gdbServer) setRegister(n int, value uint32) {
+	cpu := s.debugger.CPU
+	cpu.DiscardFuture()
+	switch n {
+	case gdbRegPC:
+		cpu.PC = uint16(value / 2)
+	case gdbRegPSR:
+		cpu.SetPSR(uint16(value))
+	default:
+		cpu.Reg[n] = uint16(value)
+	}
+}
+
+// send writes a packet to the client.
+func (s *gdbServer) send(data string) error {
+	var escaped strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch b := data[i]; b {
+		case '$', '#', '}', '*':
+			escaped.WriteByte('}')
+			escaped.WriteByte(b ^ 0x20)
+		default:
+			escaped.WriteByte(b)
+		}
+	}
+	data = escaped.String()
+	return s.write(fmt.Sprintf("$%s#%02x", data, gdbChecksum(data)))
+}
+
+func (s *gdbServer) write(data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.w, data)
+	return err
+}
+
+// gdbChecksum returns the modulo 256 sum of the packet data.
+func gdbChecksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// gdbUnescape removes the escapes from packet data.
+func gdbUnescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			b.WriteByte(data[i] ^ 0x20)
+			continue
+		}
+		b.WriteByte(data[i])
+	}
+	return b.String()
+}
+
+// gdbRange parses an "address,length" pair.
+func gdbRange(arg string) (address, length uint32, err error) {
+	parts := strings.SplitN(arg, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q", arg)
+	}
+	a, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	l, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint32(a), uint32(l), nil
+}
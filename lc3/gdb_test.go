@@ -0,0 +1,89 @@
+package lc3
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// gdbClient sends packets to a GDB server and reads the replies.
+type gdbClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *gdbClient) call(packet string) string {
+	fmt.Fprintf(c.conn, "$%s#%02x", packet, gdbChecksum(packet))
+	if ack, _ := c.r.ReadByte(); ack != '+' {
+		c.t.Fatalf("packet %q was not acknowledged", packet)
+	}
+	if start, _ := c.r.ReadByte(); start != '$' {
+		c.t.Fatalf("reply to %q does not start a packet", packet)
+	}
+	reply, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatalf("unexpected error: %v", err)
+	}
+	c.r.Discard(2)
+	return gdbUnescape(strings.TrimSuffix(reply, "#"))
+}
+
+func TestGDBServer(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0x1021 // ADD R0, R0, #1
+	m[0x3001] = 0x1021 // ADD R0, R0, #1
+	m[0x3002] = 0x1021 // ADD R0, R0, #1
+	m[0x3003] = 0xF025 // HALT
+
+	server, conn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeGDB(NewDebugger(initCPU(m)), server)
+	}()
+	c := &gdbClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	tests := []struct {
+		packet string
+		want   string
+	}{
+		{"?", "S05"},
+		{"p8", "00006000"},
+		{"m6000,4", "10211021"},
+		{"M6004,2:1262", "OK"},
+		{"s", "S05"},
+		{"Z0,6004,2", "OK"},
+		{"c", "T05swbreak:;"},
+		{"g", "00020000000000000000000030000000000060040001"},
+		{"P0=0010", "OK"},
+		{"z0,6004,2", "OK"},
+		{"c", "W00"},
+		{"p0", "0010"},
+		{"p1", "0002"},
+		{"qXfer:features:read:target.xml:0,5", "m<?xml"},
+		{"vMustReplyEmpty", ""},
+
+		// PCs above x8000 have byte addresses above 16 bits
+		{"M12000,4:10211021", "OK"},
+		{"P8=00012000", "OK"},
+		{"p8", "00012000"},
+		{"Z0,12002,2", "OK"},
+		{"c", "T05swbreak:;"},
+		{"g", "00110002000000000000000030000000000120020001"},
+		{"G00000000000000000000000000000000000110000004", "OK"},
+		{"p8", "00011000"},
+		{"p9", "0004"},
+	}
+	for _, tt := range tests {
+		if got := c.call(tt.packet); got != tt.want {
+			t.Errorf("reply to %q is %q expected %q", tt.packet, got, tt.want)
+		}
+	}
+
+	c.call("D")
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,388 @@
+package lc3
+
+// Default limits of the execution history recorded for debugging.
+const (
+	// DefaultHistorySize is the number of instructions recorded.
+	DefaultHistorySize = 100000
+
+	// DefaultCheckpointInterval is the number of instructions between copies
+	// of memory.
+	DefaultCheckpointInterval = 10000
+)
+
+// History records the changes each instruction makes to the machine, so that
+// execution can be reversed with StepBack and Rewind. The most recent
+// instructions are kept in a ring buffer, along with a copy of memory taken
+// every checkpoint interval so that long jumps do not need to undo every
+// instruction, which keeps the memory used by the history fixed.
+//
+// The registers, PC, PSR, stack pointers, cycle count and built-in device
+// registers are saved before each instruction, along with the memory
+// locations the instruction writes. The state of devices added with Attach
+// is not recorded, and output written to the console cannot be taken back.
+//
+// Once execution has been reversed, Step replays the recorded instructions
+// rather than executing them, until it reaches the newest instruction and
+// the program runs live again.
+type History struct {
+	entries     []historyEntry // ring buffer holding the entry for cycle n at n % len(entries)
+	first       uint64         // cycle of the oldest entry
+	end         uint64         // cycle after the newest entry
+	interval    uint64         // cycles between checkpoints, 0 for none
+	checkpoints []checkpoint   // copies of memory, oldest first
+	recording   *historyEntry  // entry of the instruction being executed
+
+	replaying bool         // set once execution has been reversed
+	cursor    uint64       // cycle of the next instruction to replay
+	present   machineState // the state at end, saved while replaying
+}
+
+// historyEntry is the record of a single instruction.
+type historyEntry struct {
+	state  machineState  // the state before the instruction
+	writes []memoryWrite // memory written by the instruction
+	keys   []rune        // keys the instruction took from the keyboard queue
+}
+
+// memoryWrite records a change to a memory location.
+type memoryWrite struct {
+	address  uint16
+	old, new uint16
+}
+
+// checkpoint is a copy of memory before the instruction at cycle.
+type checkpoint struct {
+	cycle  uint64
+	memory *[65536]uint16
+}
+
+// machineState holds the state of the processor and built-in devices, other
+// than memory and the keyboard queue.
+type machineState struct {
+	reg                [8]uint16
+	pc, psr            uint16
+	savedSSP, savedUSP uint16
+	cycles             uint64
+	kbsr, kbdr         uint16
+	display            display
+	timer              timer
+	mcr                uint16
+	instr              uint16
+	entries            uint64
+}
+
+// NewHistory creates a History recording the last size instructions, with a
+// checkpoint every checkpointInterval instructions. A checkpointInterval of
+// zero disables checkpoints.
+func NewHistory(size, checkpointInterval int) *History {
+	if size < 1 {
+		size = 1
+	}
+	if checkpointInterval < 0 {
+		checkpointInterval = 0
+	}
+	return &History{entries: make([]historyEntry, size), interval: uint64(checkpointInterval)}
+}
+
+// Oldest returns the cycle count of the oldest instruction that execution can
+// be reversed to.
+func (h *History) Oldest() uint64 {
+	return h.first
+}
+
+// Newest returns the cycle count after the newest instruction recorded.
+func (h *History) Newest() uint64 {
+	return h.end
+}
+
+// entry returns the entry for the instruction at cycle.
+func (h *History) entry(cycle uint64) *historyEntry {
+	return &h.entries[cycle%uint64(len(h.entries))]
+}
+
+// position returns the cycle the machine is at in the history.
+func (h *History) position() uint64 {
+	if h.replaying {
+		return h.cursor
+	}
+	return h.end
+}
+
+// sync checks that the CPU is where the history expects it to be, starting a
+// new history if it has been reset.
+func (h *History) sync(c *CPU) {
+	if c.Cycles == h.position() {
+		return
+	}
+	c.DiscardFuture()
+	h.reset(c.Cycles)
+}
+
+// reset forgets every instruction, starting a new history at cycle.
+func (h *History) reset(cycle uint64) {
+	h.first, h.end = cycle, cycle
+	h.checkpoints = h.checkpoints[:0]
+	h.replaying = false
+	h.recording = nil
+}
+
+func (c *CPU) saveState() machineState {
+	return machineState{
+		reg:      c.Reg,
+		pc:       c.PC,
+		psr:      c.PSR(),
+		savedSSP: c.SavedSSP,
+		savedUSP: c.SavedUSP,
+		cycles:   c.Cycles,
+		kbsr:     c.keyboard.status,
+		kbdr:     c.keyboard.data,
+		display:  c.display,
+		timer:    c.timer,
+		mcr:      c.mcr.value,
+		instr:    c.instr,
+		entries:  c.entries,
+	}
+}
+
+func (c *CPU) restoreState(s *machineState) {
+	c.Reg = s.reg
+	c.PC = s.pc
+	c.SetPSR(s.psr)
+	c.SavedSSP, c.SavedUSP = s.savedSSP, s.savedUSP
+	c.Cycles = s.cycles
+	c.keyboard.status, c.keyboard.data = s.kbsr, s.kbdr
+	c.display = s.display
+	c.timer = s.timer
+	c.mcr.value = s.mcr
+	c.instr, c.entries = s.instr, s.entries
+}
+
+// recordHistory starts the history entry for the next instruction.
+func (c *CPU) recordHistory() {
+	h := c.History
+	if h == nil {
+		return
+	}
+	h.sync(c)
+
+	// forget the oldest instruction once the ring buffer is full
+	if h.end-h.first == uint64(len(h.entries)) {
+		h.first++
+		if len(h.checkpoints) > 0 && h.checkpoints[0].cycle < h.first {
+			// keep the memory of the dropped checkpoint past the end of the
+			// slice, to be reused
+			n := len(h.checkpoints)
+			dropped := h.checkpoints[0]
+			copy(h.checkpoints, h.checkpoints[1:])
+			h.checkpoints[n-1] = dropped
+			h.checkpoints = h.checkpoints[:n-1]
+		}
+	}
+
+	e := h.entry(h.end)
+	e.state = c.saveState()
+	e.writes = e.writes[:0]
+	e.keys = e.keys[:0]
+	h.recording = e
+
+	if h.interval > 0 && h.end%h.interval == 0 {
+		h.checkpoint(c)
+	}
+}
+
+// checkpoint copies memory before the instruction at end, reusing the memory
+// of a checkpoint that has been dropped.
+func (h *History) checkpoint(c *CPU) {
+	n := len(h.checkpoints)
+	if n > 0 && h.checkpoints[n-1].cycle == h.end {
+		// the instruction is being retried after an error
+		return
+	}
+	if n < cap(h.checkpoints) && h.checkpoints[:n+1][n].memory != nil {
+		h.checkpoints = h.checkpoints[:n+1]
+	} else {
+		h.checkpoints = append(h.checkpoints, checkpoint{memory: new([65536]uint16)})
+	}
+	cp := &h.checkpoints[n]
+	cp.cycle = h.end
+	*cp.memory = c.Memory
+}
+
+// finishHistory completes the history entry for the instruction just
+// executed. If the instruction failed, or is a trap that will be retried,
+// the changes made by the step are undone.
+func (c *CPU) finishHistory(err error) {
+	h := c.History
+	if h == nil || h.recording == nil {
+		return
+	}
+	e := h.recording
+	h.recording = nil
+	if err != nil || c.retrying {
+		c.undo(e)
+		c.keyboard.unread(e.keys)
+		return
+	}
+	h.end++
+}
+
+// recordWrite records a write to memory by the instruction being executed.
+func (c *CPU) recordWrite(address, value uint16) {
+	if h := c.History; h != nil && h.recording != nil {
+		h.recording.writes = append(h.recording.writes, memoryWrite{address: address, old: c.Memory[address], new: value})
+	}
+}
+
+// recordKey records a key taken from the keyboard queue by the instruction
+// being executed.
+func (c *CPU) recordKey(key rune) {
+	if h := c.History; h != nil && h.recording != nil {
+		h.recording.keys = append(h.recording.keys, key)
+	}
+}
+
+// undo reverses the changes made by the instruction of an entry.
+func (c *CPU) undo(e *historyEntry) {
+	for i := len(e.writes) - 1; i >= 0; i-- {
+		c.Memory[e.writes[i].address] = e.writes[i].old
+	}
+	c.restoreState(&e.state)
+}
+
+// redo makes the changes of the next instruction to replay again.
+func (c *CPU) redo() {
+	h := c.History
+	for _, w := range h.entry(h.cursor).writes {
+		c.Memory[w.address] = w.new
+	}
+	h.cursor++
+	if h.cursor == h.end {
+		c.restoreState(&h.present)
+		h.replaying = false
+		return
+	}
+	c.restoreState(&h.entry(h.cursor).state)
+}
+
+// replay executes the next instruction from the history.
+func (c *CPU) replay() error {
+	c.redo()
+	if !c.mcr.clockEnabled() {
+		c.setState(RunStateHalted)
+	}
+	return nil
+}
+
+// reverse saves the present state the first time execution is reversed.
+func (h *History) reverse(c *CPU) {
+	if !h.replaying {
+		h.present = c.saveState()
+		h.cursor = h.end
+		h.replaying = true
+	}
+}
+
+// StepBack reverses the last instruction executed. It returns ErrNoHistory if
+// there is no History or it does not go back any further.
+func (c *CPU) StepBack() error {
+	h := c.History
+	if h == nil {
+		return ErrNoHistory
+	}
+	h.sync(c)
+	if h.position() == h.first {
+		return ErrNoHistory
+	}
+
+	h.reverse(c)
+	h.cursor--
+	c.undo(h.entry(h.cursor))
+	if c.State() != RunStateRunning {
+		c.rewound()
+	}
+	return nil
+}
+
+// Rewind moves execution backwards or forwards to the instruction at cycle,
+// which must be in the History. Moving forwards replays the recorded
+// instructions.
+func (c *CPU) Rewind(cycle uint64) error {
+	h := c.History
+	if h == nil {
+		return ErrNoHistory
+	}
+	h.sync(c)
+	if cycle < h.first || cycle > h.end {
+		return ErrNoHistory
+	}
+	if cycle == h.position() {
+		return nil
+	}
+	h.reverse(c)
+
+	// start from the nearest checkpoint if it is closer than the cursor
+	distance := func(a, b uint64) uint64 {
+		if a > b {
+			return a - b
+		}
+		return b - a
+	}
+	for i := len(h.checkpoints) - 1; i >= 0; i-- {
+		cp := &h.checkpoints[i]
+		if cp.cycle > cycle || cp.cycle >= h.end {
+			continue
+		}
+		if cycle-cp.cycle < distance(cycle, h.cursor) {
+			c.Memory = *cp.memory
+			h.cursor = cp.cycle
+			c.restoreState(&h.entry(h.cursor).state)
+		}
+		break
+	}
+
+	for h.cursor > cycle {
+		h.cursor--
+		c.undo(h.entry(h.cursor))
+	}
+	for h.replaying && h.cursor < cycle {
+		c.redo()
+	}
+	if c.State() != RunStateRunning {
+		c.rewound()
+	}
+	return nil
+}
+
+// rewound sets the run state after the machine has been moved to another
+// instruction in the history, as it may no longer be halted.
+func (c *CPU) rewound() {
+	if c.mcr.clockEnabled() {
+		c.setState(RunStateStopped)
+	} else {
+		c.setState(RunStateHalted)
+	}
+}
+
+// DiscardFuture drops the instructions recorded after the current one once
+// execution has been reversed, so that the program runs live from here. Keys
+// that the dropped instructions read are returned to the keyboard queue.
+// Debuggers call it before changing registers or memory, since the recorded
+// instructions would no longer be valid.
+func (c *CPU) DiscardFuture() {
+	h := c.History
+	if h == nil || !h.replaying {
+		return
+	}
+
+	var keys []rune
+	for cycle := h.cursor; cycle < h.end; cycle++ {
+		keys = append(keys, h.entry(cycle).keys...)
+	}
+	c.keyboard.unread(keys)
+
+	h.end = h.cursor
+	h.replaying = false
+	for len(h.checkpoints) > 0 && h.checkpoints[len(h.checkpoints)-1].cycle >= h.end {
+		h.checkpoints = h.checkpoints[:len(h.checkpoints)-1]
+	}
+}
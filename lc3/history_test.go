@@ -0,0 +1,179 @@
+package lc3
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const historyProgram = `
+	.ORIG x3000
+	AND R1, R1, #0
+	ADD R1, R1, #5
+	LEA R2, BUF
+LOOP	STR R1, R2, #0
+	ADD R2, R2, #1
+	ADD R1, R1, #-1
+	BRp LOOP
+	GETC
+	ST R0, KEY
+	HALT
+KEY	.FILL #0
+BUF	.BLKW 5
+	.END
+`
+
+type historyState struct {
+	reg    [8]uint16
+	pc     uint16
+	psr    uint16
+	cycles uint64
+	memory [65536]uint16
+}
+
+func currentState(c *CPU) historyState {
+	return historyState{reg: c.Reg, pc: c.PC, psr: c.PSR(), cycles: c.Cycles, memory: c.Memory}
+}
+
+// historyCPU loads the history test program with a key waiting, and a
+// history of size instructions.
+func historyCPU(t *testing.T, size, interval int) *CPU {
+	p, err := Assemble("history.asm", strings.NewReader(historyProgram))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := NewCPU()
+	cpu.Console = NewConsole(strings.NewReader(""), ioutil.Discard)
+	cpu.Load(p)
+	cpu.Reset()
+	cpu.PushKey('k')
+	cpu.History = NewHistory(size, interval)
+	return cpu
+}
+
+// runRecording runs the CPU until it halts, returning the state before each
+// instruction and the final state.
+func runRecording(t *testing.T, cpu *CPU) []historyState {
+	var states []historyState
+	cpu.start()
+	for cpu.State() == RunStateRunning {
+		states = append(states, currentState(cpu))
+		if err := cpu.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return append(states, currentState(cpu))
+}
+
+func checkState(t *testing.T, cpu *CPU, want historyState, context string) {
+	t.Helper()
+	got := currentState(cpu)
+	if got.reg != want.reg || got.pc != want.pc || got.psr != want.psr || got.cycles != want.cycles {
+		t.Errorf("%s: state is PC x%04X cycle %d %v expected PC x%04X cycle %d %v",
+			context, got.pc, got.cycles, got.reg, want.pc, want.cycles, want.reg)
+	}
+	if got.memory != want.memory {
+		t.Errorf("%s: memory differs", context)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	cpu := historyCPU(t, 1000, 8)
+	states := runRecording(t, cpu)
+	if cpu.Memory[0x300A] != 'k' {
+		t.Fatalf("program stored x%04X expected the key", cpu.Memory[0x300A])
+	}
+
+	// step back to the start
+	for i := len(states) - 2; i >= 0; i-- {
+		if err := cpu.StepBack(); err != nil {
+			t.Fatalf("step back to cycle %d: %v", i, err)
+		}
+		checkState(t, cpu, states[i], "step back")
+	}
+	if err := cpu.StepBack(); err != ErrNoHistory {
+		t.Errorf("step back past the start returned %v expected %v", err, ErrNoHistory)
+	}
+	if cpu.State() != RunStateStopped {
+		t.Errorf("state is %d after stepping back expected %d", cpu.State(), RunStateStopped)
+	}
+
+	// replay forwards to the end
+	cpu.start()
+	for i := 1; i < len(states); i++ {
+		if err := cpu.Step(); err != nil {
+			t.Fatal(err)
+		}
+		checkState(t, cpu, states[i], "replay")
+	}
+	if cpu.State() != RunStateHalted {
+		t.Errorf("state is %d after replaying expected %d", cpu.State(), RunStateHalted)
+	}
+
+	// jump around, using the checkpoints
+	for _, cycle := range []int{3, 20, 17, 0, len(states) - 1, 9} {
+		if err := cpu.Rewind(uint64(cycle)); err != nil {
+			t.Fatalf("rewind to %d: %v", cycle, err)
+		}
+		checkState(t, cpu, states[cycle], "rewind")
+	}
+	if err := cpu.Rewind(uint64(len(states))); err != ErrNoHistory {
+		t.Errorf("rewind past the end returned %v expected %v", err, ErrNoHistory)
+	}
+
+	// running live from the past reads the same key again
+	cpu.DiscardFuture()
+	cpu.Memory[0x300A] = 0
+	if err := cpu.Run(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, cpu, states[len(states)-1], "run again")
+}
+
+func TestHistoryRingBuffer(t *testing.T) {
+	cpu := historyCPU(t, 10, 4)
+	states := runRecording(t, cpu)
+	end := len(states) - 1
+
+	if cpu.History.Oldest() != uint64(end-10) || cpu.History.Newest() != uint64(end) {
+		t.Errorf("history holds cycles %d to %d expected %d to %d", cpu.History.Oldest(), cpu.History.Newest(), end-10, end)
+	}
+	for i := 1; i <= 10; i++ {
+		if err := cpu.StepBack(); err != nil {
+			t.Fatalf("step back %d: %v", i, err)
+		}
+	}
+	checkState(t, cpu, states[end-10], "oldest")
+	if err := cpu.StepBack(); err != ErrNoHistory {
+		t.Errorf("step back past the oldest instruction returned %v expected %v", err, ErrNoHistory)
+	}
+	if err := cpu.Rewind(uint64(end - 1)); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, cpu, states[end-1], "rewind")
+}
+
+func TestDebuggerReverse(t *testing.T) {
+	cpu := historyCPU(t, 1000, 0)
+	d := NewDebugger(cpu)
+	if reason, err := d.Continue(); reason != StopHalted || err != nil {
+		t.Fatalf("continue stopped with %d, %v", reason, err)
+	}
+
+	d.SetBreakpoint(0x3004)
+	reason, err := d.ReverseContinue()
+	if reason != StopBreakpoint || err != nil || cpu.PC != 0x3004 || cpu.Reg[1] != 1 {
+		t.Errorf("reverse continue stopped with %d, %v at x%04X with R1 %d", reason, err, cpu.PC, cpu.Reg[1])
+	}
+	if reason, _ := d.StepBack(); reason != StopStep || cpu.PC != 0x3003 {
+		t.Errorf("step back stopped with %d at x%04X", reason, cpu.PC)
+	}
+
+	d.ClearBreakpoint(0x3004)
+	if reason, _ := d.ReverseContinue(); reason != StopHistoryStart || cpu.PC != 0x3000 {
+		t.Errorf("reverse continue stopped with %d at x%04X", reason, cpu.PC)
+	}
+	if reason, _ := d.Continue(); reason != StopHalted || cpu.Memory[0x300A] != 'k' {
+		t.Errorf("continue stopped with %d and stored x%04X", reason, cpu.Memory[0x300A])
+	}
+}
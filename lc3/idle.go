@@ -0,0 +1,92 @@
+package lc3
+
+import "time"
+
+const (
+	idleLoopLength = 8 // most instructions between polls of KBSR in a polling loop
+	idlePolls      = 4 // polls from the same loop before the program is idle
+)
+
+// idleDetector spots programs waiting for a key in a tight loop that polls
+// KBSR, so that the VM can sleep instead of spinning.
+type idleDetector struct {
+	pc      uint16 // instruction that last found KBSR not ready
+	cycle   uint64 // value of Cycles after it executed
+	polls   int    // polls from pc, each within idleLoopLength instructions
+	written bool   // a device register or the console was written since the last poll
+}
+
+// poll records that the instruction at pc found no key ready, returning true
+// once the same instruction has done so repeatedly in a tight loop that
+// writes no output, such as a spinner, between the polls.
+func (d *idleDetector) poll(pc uint16, cycle uint64) bool {
+	if pc == d.pc && cycle > d.cycle && cycle-d.cycle <= idleLoopLength && !d.written {
+		d.polls++
+	} else {
+		d.polls = 1
+	}
+	d.pc, d.cycle, d.written = pc, cycle, false
+	return d.polls >= idlePolls
+}
+
+// runStep executes an instruction for Run and the Debugger. If the program is
+// polling KBSR in a tight loop it then sleeps until a key is pressed, the
+// timer is due to expire or the CPU is stopped.
+func (c *CPU) runStep() error {
+	pc := c.PC
+	c.keyboard.polled = false
+	if err := c.Step(); err != nil {
+		return err
+	}
+	if c.keyboard.polled && c.idle.poll(pc, c.Cycles) && c.State() == RunStateRunning {
+		return c.sleep()
+	}
+	return nil
+}
+
+// sleep waits for a key, unless something other than a key could end the
+// polling loop. Only the timer in millisecond mode is waited for, since the
+// instruction counting devices make no progress while the CPU sleeps. It
+// returns ErrNoInput if the input has been closed and used up, as the program
+// would then wait forever.
+func (c *CPU) sleep() error {
+	if c.keyboard.replaying || c.display.busy > 0 || c.clockedDevices() {
+		return nil
+	}
+
+	var expired <-chan time.Time
+	if t := &c.timer; t.control&tcrEnable != 0 && t.interval != 0 {
+		if t.control&tcrMilliseconds == 0 || !t.started {
+			return nil
+		}
+		period := time.Duration(t.interval) * time.Millisecond
+		wait := time.Until(t.start.Add(period))
+		if wait <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		expired = timer.C
+	} else if c.keyboard.queue.exhausted() {
+		return c.fault(ErrNoInput)
+	}
+	c.keyboard.queue.wait(expired)
+	return nil
+}
+
+// clockedDevices returns true if a device added with Attach updates its state
+// or requests interrupts as the CPU runs.
+func (c *CPU) clockedDevices() bool {
+	for _, m := range c.devices {
+		switch m.device {
+		case &c.keyboard, &c.display, &c.timer, &c.mcr:
+			continue
+		}
+		_, ticker := m.device.(Ticker)
+		_, interrupter := m.device.(Interrupter)
+		if ticker || interrupter {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package lc3
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runFor runs the CPU for d before stopping it, returning the error from Run.
+func runFor(t *testing.T, cpu *CPU, d time.Duration) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		done <- cpu.Run()
+	}()
+	time.Sleep(d)
+	cpu.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("the CPU did not stop")
+		return nil
+	}
+}
+
+func TestCPUIdlePolling(t *testing.T) {
+	cpu := replayCPU(t)
+	if err := runFor(t, cpu, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// it sleeps after the fourth poll, before the branch back
+	if cpu.Cycles != 2*idlePolls-1 || cpu.PC != 0x3001 {
+		t.Errorf("ran %d instructions to PC x%04X while polling expected %d to x3001", cpu.Cycles, cpu.PC, 2*idlePolls-1)
+	}
+
+	// a key pressed while the CPU sleeps wakes it
+	done := make(chan error, 1)
+	go func() {
+		done <- cpu.Run()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cpu.PushKey('a')
+	cpu.PushKey('b')
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		cpu.Stop()
+		t.Fatal("the key did not wake the CPU")
+	}
+	if cpu.State() != RunStateHalted || cpu.Memory[0x3007] != 'a' || cpu.Memory[0x3008] != 'b' {
+		t.Errorf("state %d and read x%04X and x%04X expected %d, 'a' and 'b'",
+			cpu.State(), cpu.Memory[0x3007], cpu.Memory[0x3008], RunStateHalted)
+	}
+}
+
+func TestCPUIdleTimer(t *testing.T) {
+	p, err := Assemble("timer.asm", strings.NewReader(`
+	.ORIG x3000
+	LD R0, INTERVAL
+	STI R0, TIR
+	LD R0, CONTROL
+	STI R0, TCR
+POLL	LDI R1, TSR
+	BRn DONE
+	LDI R1, KBSR
+	BRzp POLL
+DONE	HALT
+INTERVAL	.FILL #20
+CONTROL	.FILL xA000
+TCR	.FILL xFE08
+TIR	.FILL xFE0A
+TSR	.FILL xFE0C
+KBSR	.FILL xFE00
+	.END
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := NewCPU()
+	cpu.Console = NewConsole(strings.NewReader(""), ioutil.Discard)
+	cpu.Load(p)
+	cpu.Reset()
+
+	// the millisecond timer wakes the CPU when it expires
+	done := make(chan error, 1)
+	go func() {
+		done <- cpu.Run()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		cpu.Stop()
+		t.Fatal("the timer did not wake the CPU")
+	}
+	if cpu.Cycles > 100 {
+		t.Errorf("ran %d instructions while polling", cpu.Cycles)
+	}
+}
+
+func TestCPUIdlePrinting(t *testing.T) {
+	p, err := Assemble("spinner.asm", strings.NewReader(`
+	.ORIG x3000
+	LD R2, DOT
+POLL	LDI R1, KBSR
+	BRn DONE
+	STI R2, DDR
+	BRnzp POLL
+DONE	HALT
+DOT	.FILL x2E
+KBSR	.FILL xFE00
+DDR	.FILL xFE06
+	.END
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	cpu := NewCPU()
+	cpu.Console = NewConsole(strings.NewReader(""), &out)
+	cpu.Load(p)
+	cpu.Reset()
+
+	// a loop that prints while it polls is not idle, even with no display delay
+	if err := runFor(t, cpu, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.Cycles < 1000 || out.Len() < 250 {
+		t.Errorf("ran %d instructions printing %d characters while polling", cpu.Cycles, out.Len())
+	}
+}
+
+func TestCPUIdleInputClosed(t *testing.T) {
+	p, err := Assemble("echo.asm", strings.NewReader(`
+	.ORIG x3000
+POLL	LDI R1, KBSR
+	BRzp POLL
+	LDI R0, KBDR
+	STI R0, DDR
+	BRnzp POLL
+KBSR	.FILL xFE00
+KBDR	.FILL xFE02
+DDR	.FILL xFE06
+	.END
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// run headless, with piped input that runs out
+	var out bytes.Buffer
+	cpu := NewCPU()
+	cpu.Console = NewConsole(strings.NewReader("ab"), &out)
+	cpu.Load(p)
+	cpu.Reset()
+	go cpu.ReadConsole()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cpu.Run()
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrNoInput) {
+			t.Errorf("error %v expected %v", err, ErrNoInput)
+		}
+	case <-time.After(time.Second):
+		cpu.Stop()
+		t.Fatal("the CPU kept waiting for input after it ran out")
+	}
+	if out.String() != "ab" {
+		t.Errorf("output %q expected %q", out.String(), "ab")
+	}
+}
+
+func TestCPUGetcBlocks(t *testing.T) {
+	m := [65536]uint16{}
+	m[0x3000] = 0xF020 // GETC
+
+	cpu := initCPU(m)
+	cpu.Console = NewConsole(strings.NewReader(""), ioutil.Discard)
+	if err := runFor(t, cpu, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// the stopped trap has not executed
+	if cpu.PC != 0x3000 || cpu.Cycles != 0 {
+		t.Errorf("c.PC 0x%04x after %d instructions expected 0x3000 after 0", cpu.PC, cpu.Cycles)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cpu.PushKey('g')
+	}()
+	cpu.start()
+	if err := cpu.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.Reg[0] != 'g' {
+		t.Errorf("c.Reg[0] 0x%04x expected 0x%04x", cpu.Reg[0], 'g')
+	}
+}
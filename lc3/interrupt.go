@@ -0,0 +1,61 @@
+package lc3
+
+// Interrupt vectors and priorities
+const (
+	// Keyboard interrupt vector
+	IntKeyboard uint16 = 0x80
+
+	// Priority level of keyboard interrupts
+	PriorityKeyboard uint16 = 4
+
+	// Timer interrupt vector
+	IntTimer uint16 = 0x81
+)
+
+// Interrupt is a request from a device for the processor to run an interrupt
+// service routine.
+type Interrupt struct {
+	Vector   uint16 // offset into the interrupt vector table
+	Priority uint16 // priority level, PL0 to PL7
+}
+
+// serviceInterrupts starts the service routine for the highest priority
+// interrupt request, if its priority is above the current priority level. The
+// PSR and PC are pushed onto the supervisor stack so that RTI can resume the
+// interrupted program. An interrupt without a service routine in the
+// interrupt vector table is a fault.
+func (c *CPU) serviceInterrupts() error {
+	req, ok := c.pendingInterrupt()
+	if !ok || req.Priority <= c.Priority {
+		return nil
+	}
+
+	handler, err := c.ReadMemory(IntVectorTable + req.Vector)
+	if err != nil {
+		return err
+	}
+	if handler == 0 {
+		return c.fault(ErrNoHandler)
+	}
+	if err = c.enterSupervisor(c.PC); err != nil {
+		return err
+	}
+	c.Priority = req.Priority
+	c.PC = handler
+	return nil
+}
+
+// pendingInterrupt returns the highest priority interrupt being requested by
+// the attached devices.
+func (c *CPU) pendingInterrupt() (req Interrupt, ok bool) {
+	for _, m := range c.devices {
+		source, isInterrupter := m.device.(Interrupter)
+		if !isInterrupter {
+			continue
+		}
+		if r, requested := source.Interrupt(); requested && (!ok || r.Priority > req.Priority) {
+			req, ok = r, true
+		}
+	}
+	return req, ok
+}
@@ -0,0 +1,201 @@
+package lc3
+
+import (
+	"sync"
+	"time"
+)
+
+// Keyboard status register bits
+const (
+	kbsrReady  uint16 = 0x8000 // KBSR[15], set when a key is waiting in KBDR
+	kbsrEnable uint16 = 0x4000 // KBSR[14], set to enable keyboard interrupts
+)
+
+// keyboard is the device behind the keyboard status and data registers.
+type keyboard struct {
+	status uint16   // KBSR
+	data   uint16   // KBDR
+	queue  keyQueue // keys waiting to be moved into KBDR
+	polled bool     // set when KBSR is read while no key is ready
+
+	replaying  bool         // deliver the replay events instead of the buffer
+	replay     []InputEvent // recorded keys being replayed
+	replayNext int          // index of the next replay event
+}
+
+func (k *keyboard) Read(address uint16) (uint16, error) {
+	switch address {
+	case MemRegKBSR:
+		if k.status&kbsrReady == 0 {
+			k.polled = true
+		}
+		return k.status, nil
+	case MemRegKBDR:
+		// reading the data register clears the ready bit
+		k.status &^= kbsrReady
+		return k.data, nil
+	}
+	return 0, nil
+}
+
+func (k *keyboard) Write(address uint16, value uint16) error {
+	// only the interrupt enable bit of KBSR can be written
+	if address == MemRegKBSR {
+		k.status = (k.status &^ kbsrEnable) | (value & kbsrEnable)
+	}
+	return nil
+}
+
+// Interrupt requests a keyboard interrupt while a key is ready and
+// interrupts are enabled.
+func (k *keyboard) Interrupt() (Interrupt, bool) {
+	if k.status&kbsrReady != 0 && k.status&kbsrEnable != 0 {
+		return Interrupt{Vector: IntKeyboard, Priority: PriorityKeyboard}, true
+	}
+	return Interrupt{}, false
+}
+
+// update moves the next key into KBDR once the previous key has been read.
+// It returns the key moved, if any.
+func (k *keyboard) update(cycle uint64) (rune, bool) {
+	if k.status&kbsrReady != 0 {
+		return 0, false
+	}
+	key, ok := k.next(cycle, false)
+	if ok {
+		k.data = uint16(key)
+		k.status |= kbsrReady
+	}
+	return key, ok
+}
+
+// next removes the next key for the program to read at cycle, from the
+// replay events when input is being replayed or from the buffer otherwise.
+// trap is set when the key is read by a trap routine.
+func (k *keyboard) next(cycle uint64, trap bool) (rune, bool) {
+	if !k.replaying {
+		return k.queue.pop()
+	}
+	if k.replayNext < len(k.replay) {
+		if e := k.replay[k.replayNext]; e.Cycle == cycle && e.Trap == trap {
+			k.replayNext++
+			return e.Key, true
+		}
+	}
+	return 0, false
+}
+
+// unread returns keys to the front of the queue, or to the replay events
+// they came from.
+func (k *keyboard) unread(keys []rune) {
+	if k.replaying {
+		k.replayNext -= len(keys)
+		return
+	}
+	k.queue.unread(keys)
+}
+
+// keyQueue holds the keys pressed but not yet read by the program. Keys are
+// pushed by the goroutine reading the console and removed by the CPU, so
+// every method is safe to call concurrently.
+type keyQueue struct {
+	mu     sync.Mutex
+	keys   []rune
+	closed bool          // set once the console has no more input
+	ready  chan struct{} // signalled when a key is pushed, or by wake
+}
+
+// push adds a key to the end of the queue.
+func (q *keyQueue) push(key rune) {
+	q.mu.Lock()
+	q.keys = append(q.keys, key)
+	q.mu.Unlock()
+	q.wake()
+}
+
+// pop removes the next key from the queue, returning false if it is empty.
+func (q *keyQueue) pop() (rune, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.keys) == 0 {
+		return 0, false
+	}
+	key := q.keys[0]
+	q.keys = q.keys[1:]
+	return key, true
+}
+
+// unread returns keys to the front of the queue.
+func (q *keyQueue) unread(keys []rune) {
+	if len(keys) == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.keys = append(append([]rune{}, keys...), q.keys...)
+	q.mu.Unlock()
+}
+
+// close marks the end of the input. Keys already in the queue can still be
+// read.
+func (q *keyQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.wake()
+}
+
+// wake ends the current or next call to wait.
+func (q *keyQueue) wake() {
+	select {
+	case q.signal() <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until a key is pushed, the input is closed, wake is called or
+// a value is received from timeout. It returns straight away if keys are
+// waiting in the queue.
+func (q *keyQueue) wait(timeout <-chan time.Time) {
+	q.mu.Lock()
+	waiting := len(q.keys) > 0
+	q.mu.Unlock()
+	if waiting {
+		return
+	}
+	select {
+	case <-q.signal():
+	case <-timeout:
+	}
+}
+
+// signal returns the channel used to wake wait, creating it on first use.
+func (q *keyQueue) signal() chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ready == nil {
+		q.ready = make(chan struct{}, 1)
+	}
+	return q.ready
+}
+
+// exhausted returns true once the input has been closed and every key in the
+// queue has been read.
+func (q *keyQueue) exhausted() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed && len(q.keys) == 0
+}
+
+// waiting returns a copy of the keys in the queue.
+func (q *keyQueue) waiting() []rune {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]rune{}, q.keys...)
+}
+
+// replace replaces the keys in the queue.
+func (q *keyQueue) replace(keys []rune) {
+	q.mu.Lock()
+	q.keys = keys
+	q.mu.Unlock()
+}
@@ -0,0 +1,104 @@
+package lc3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// lc3simRegister matches a register value in lc3sim's register dump, such as
+// "PC=x3000" or "R0=x0000".
+var lc3simRegister = regexp.MustCompile(`\b(PC|IR|PSR|R[0-7])=x([0-9A-Fa-f]{4})\b`)
+
+// lc3simDump is the machine state shown by one lc3sim register dump.
+type lc3simDump struct {
+	pc, ir, psr uint16
+	reg         [8]uint16
+	seen        int // number of the 11 values seen so far
+}
+
+// ReadLC3SimTrace reads a reference trace from the output of lc3sim, the
+// simulator in Steven Lumetta's lc3tools, captured while single-stepping a
+// program with its step command. lc3sim prints the machine state after each
+// command as a register dump:
+//
+//	PC=x3001 IR=x5020 PSR=x0002 (ZERO)
+//	R0=x0000 R1=x0000 R2=x0000 R3=x0000
+//	R4=x0000 R5=x0000 R6=x0000 R7=x0000
+//
+// The first dump is the state before the first instruction, and each later
+// dump is the state after one instruction, whose address is the PC of the
+// dump before it. Other output, such as prompts and disassembly, is ignored.
+//
+// The dumps do not show memory, so the records hold no reads or writes and
+// CompareTrace does not compare memory writes with them. Only the condition
+// codes of the PSR are compared, since lc3sim runs programs under its own
+// operating system, at its own privilege and priority level.
+func ReadLC3SimTrace(r io.Reader) ([]TraceRecord, error) {
+	var (
+		records []TraceRecord
+		prev    *lc3simDump
+		dump    lc3simDump
+		dumps   int
+	)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		for _, m := range lc3simRegister.FindAllStringSubmatch(scanner.Text(), -1) {
+			value, _ := strconv.ParseUint(m[2], 16, 16)
+			switch name := m[1]; name {
+			case "PC":
+				if dump.seen != 0 {
+					return records, fmt.Errorf("line %d: register dump %d is incomplete", line, dumps+1)
+				}
+				dump.pc = uint16(value)
+			case "IR":
+				dump.ir = uint16(value)
+			case "PSR":
+				dump.psr = uint16(value)
+			default:
+				dump.reg[name[1]-'0'] = uint16(value)
+			}
+			dump.seen++
+		}
+		if dump.seen < 11 {
+			continue
+		}
+
+		if prev != nil {
+			records = append(records, lc3simRecord(prev, &dump, uint64(len(records))))
+		}
+		d := dump
+		prev = &d
+		dump = lc3simDump{}
+		dumps++
+	}
+	if err := scanner.Err(); err != nil {
+		return records, err
+	}
+	if dump.seen != 0 {
+		return records, fmt.Errorf("register dump %d is incomplete", dumps+1)
+	}
+	return records, nil
+}
+
+// lc3simRecord returns the record of the instruction executed between two
+// register dumps. The instruction's destination register is listed even when
+// its value does not change, as the simulators' initial registers can differ.
+func lc3simRecord(before, after *lc3simDump, cycle uint64) TraceRecord {
+	rec := TraceRecord{
+		Cycle:         cycle,
+		PC:            before.pc,
+		Instr:         after.ir,
+		PSR:           after.psr,
+		registersOnly: true,
+	}
+	dest, hasDest := destRegister(after.ir, false, SecondEdition)
+	for r := range after.reg {
+		if after.reg[r] != before.reg[r] || (hasDest && uint16(r) == dest) {
+			rec.Regs = append(rec.Regs, RegWrite{Reg: uint8(r), Value: after.reg[r]})
+		}
+	}
+	return rec
+}
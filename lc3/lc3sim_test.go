@@ -0,0 +1,54 @@
+package lc3
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadLC3SimTrace(t *testing.T) {
+	records, err := ReadLC3SimTrace(strings.NewReader(`
+PC=x3000 IR=x0000 PSR=x8002 (ZERO)
+R0=x0000 R1=x7FFF R2=x0000 R3=x0000
+R4=x0000 R5=x0000 R6=x0000 R7=x0000
+                  x3000 x1262 ADD R1,R1,#2
+(lc3sim) step
+PC=x3001 IR=x1262 PSR=x8004 (NEGATIVE)
+R0=x0000 R1=x8001 R2=x0000 R3=x0000
+R4=x0000 R5=x0000 R6=x0000 R7=x0000
+                  x3001 x0FFE BRNZP x3000
+(lc3sim) step
+PC=x3000 IR=x0FFE PSR=x8004 (NEGATIVE)
+R0=x0000 R1=x8001 R2=x0000 R3=x0000 R4=x0000 R5=x0000 R6=x0000 R7=x0000
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TraceRecord{
+		{Cycle: 0, PC: 0x3000, Instr: 0x1262, Regs: []RegWrite{{1, 0x8001}}, PSR: 0x8004, registersOnly: true},
+		{Cycle: 1, PC: 0x3001, Instr: 0x0FFE, PSR: 0x8004, registersOnly: true},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("records %+v expected %+v", records, expected)
+	}
+
+	// the destination register is listed even when its value is unchanged
+	records, err = ReadLC3SimTrace(strings.NewReader(`
+PC=x3000 IR=x0000 PSR=x0002 (ZERO)
+R0=x0000 R1=x0000 R2=x0000 R3=x0000 R4=x0000 R5=x0000 R6=x0000 R7=x0000
+PC=x3001 IR=x5DA0 PSR=x0002 (ZERO)
+R0=x0000 R1=x0000 R2=x0000 R3=x0000 R4=x0000 R5=x0000 R6=x0000 R7=x0000
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !reflect.DeepEqual(records[0].Regs, []RegWrite{{6, 0}}) {
+		t.Errorf("records %+v expected one writing R6=x0000", records)
+	}
+
+	// a dump cut short is an error
+	_, err = ReadLC3SimTrace(strings.NewReader("PC=x3000 IR=x0000 PSR=x0002 (ZERO)\nR0=x0000 R1=x0000\n"))
+	if err == nil || err.Error() != "register dump 1 is incomplete" {
+		t.Errorf("error %v expected register dump 1 is incomplete", err)
+	}
+}
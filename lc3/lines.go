@@ -0,0 +1,115 @@
+package lc3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LineEntry records the source line an instruction was assembled from.
+type LineEntry struct {
+	File    string
+	Line    int
+	Address uint16
+}
+
+// LineTable maps the source lines of a program to the addresses of the
+// words assembled from them.
+type LineTable []LineEntry
+
+// ReadLineTable reads a line table. Each line of the table lists a source
+// file, a line number and the address in hexadecimal, and lines starting
+// with // are comments:
+//
+//	// Line table
+//	hello.asm 3 3000
+//	hello.asm 4 3001
+func ReadLineTable(r io.Reader) (LineTable, error) {
+	var table LineTable
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line table line %d: expected file, line and address", n)
+		}
+		line, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line table line %d: invalid line number %q", n, fields[1])
+		}
+		address, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(fields[2]), "x"), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line table line %d: invalid address %q", n, fields[2])
+		}
+		table = append(table, LineEntry{File: fields[0], Line: line, Address: uint16(address)})
+	}
+	return table, scanner.Err()
+}
+
+// LoadLineTable reads a line table file. Relative source file names are
+// resolved against the directory of the line table.
+func LoadLineTable(filename string) (LineTable, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	table, err := ReadLineTable(file)
+	if err != nil {
+		return nil, err
+	}
+	for i := range table {
+		if !filepath.IsAbs(table[i].File) {
+			table[i].File = filepath.Join(filepath.Dir(filename), table[i].File)
+		}
+	}
+	return table, nil
+}
+
+// WriteTo writes the line table in the format read by ReadLineTable.
+func (t LineTable) WriteTo(w io.Writer) (int64, error) {
+	b := &strings.Builder{}
+	b.WriteString("// Line table\n")
+	for _, e := range t {
+		fmt.Fprintf(b, "%s %d %04X\n", e.File, e.Line, e.Address)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Address returns the address of the first word assembled from line of
+// file. Files are matched by name when the paths differ.
+func (t LineTable) Address(file string, line int) (uint16, bool) {
+	for _, e := range t {
+		if e.Line == line && sameFile(e.File, file) {
+			return e.Address, true
+		}
+	}
+	return 0, false
+}
+
+// Line returns the source line that the word at address was assembled from.
+func (t LineTable) Line(address uint16) (LineEntry, bool) {
+	for _, e := range t {
+		if e.Address == address {
+			return e, true
+		}
+	}
+	return LineEntry{}, false
+}
+
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	return filepath.Base(a) == filepath.Base(b)
+}
@@ -0,0 +1,25 @@
+package lc3
+
+// Machine control register bits
+const (
+	mcrClockEnable uint16 = 0x8000 // MCR[15], the machine runs while it is set
+)
+
+// machineControl is the device behind the Machine Control Register.
+type machineControl struct {
+	value uint16 // MCR
+}
+
+func (m *machineControl) Read(address uint16) (uint16, error) {
+	return m.value, nil
+}
+
+func (m *machineControl) Write(address uint16, value uint16) error {
+	m.value = value
+	return nil
+}
+
+// clockEnabled reports whether the clock enable bit is set.
+func (m *machineControl) clockEnabled() bool {
+	return m.value&mcrClockEnable != 0
+}
@@ -0,0 +1,161 @@
+package lc3
+
+// Interrupt Vector Table
+const (
+	// Start of the interrupt vector table. Exception and interrupt vectors
+	// are offsets into this table.
+	IntVectorTable uint16 = 0x0100
+
+	// Privilege mode violation exception
+	ExcPrivilege uint16 = 0x00
+
+	// Illegal opcode exception
+	ExcIllegalOpcode uint16 = 0x01
+
+	// Access control violation exception
+	ExcAccessViolation uint16 = 0x02
+)
+
+// Memory that can only be accessed in supervisor mode
+const (
+	// End of the system space holding the vector tables and operating system
+	SystemSpaceEnd uint16 = 0x2FFF
+
+	// Start of the device register address space
+	DeviceSpaceStart uint16 = 0xFE00
+)
+
+// Processor Status Register fields
+const (
+	psrUser     uint16 = 0x8000 // PSR[15], set in user mode
+	psrPriority uint16 = 0x0700 // PSR[10:8], the priority level
+	psrN        uint16 = 0x0004 // PSR[2], negative
+	psrZ        uint16 = 0x0002 // PSR[1], zero
+	psrP        uint16 = 0x0001 // PSR[0], positive
+)
+
+// defaultSSP is the initial supervisor stack pointer.
+const defaultSSP uint16 = 0x3000
+
+// PSR returns the Processor Status Register, built from the privilege mode,
+// priority level and condition codes.
+func (c *CPU) PSR() uint16 {
+	var psr uint16
+	if c.UserMode {
+		psr |= psrUser
+	}
+	psr |= (c.Priority << 8) & psrPriority
+	if c.CondRegister.N {
+		psr |= psrN
+	}
+	if c.CondRegister.Z {
+		psr |= psrZ
+	}
+	if c.CondRegister.P {
+		psr |= psrP
+	}
+	return psr
+}
+
+// SetPSR sets the privilege mode, priority level and condition codes from a
+// Processor Status Register value. The stack pointers are not changed.
+func (c *CPU) SetPSR(psr uint16) {
+	c.UserMode = psr&psrUser != 0
+	c.Priority = (psr & psrPriority) >> 8
+	c.CondRegister.N = psr&psrN != 0
+	c.CondRegister.Z = psr&psrZ != 0
+	c.CondRegister.P = psr&psrP != 0
+}
+
+// enterSupervisor switches to supervisor mode, swapping to the supervisor
+// stack if the processor was in user mode, and pushes the PSR and the return
+// address pc onto the supervisor stack.
+func (c *CPU) enterSupervisor(pc uint16) error {
+	c.entries++
+	psr := c.PSR()
+	if c.UserMode {
+		c.SavedUSP = c.Reg[6]
+		c.Reg[6] = c.SavedSSP
+		c.UserMode = false
+	}
+	if err := c.push(psr); err != nil {
+		return err
+	}
+	return c.push(pc)
+}
+
+// exception raises an exception for the instruction instr at the current PC.
+// If a handler is installed in the interrupt vector table the processor
+// enters supervisor mode and jumps to it, with pc as the return address.
+// Otherwise an error describing the exception is returned.
+func (c *CPU) exception(vector uint16, pc uint16, instr uint16) error {
+	handler, err := c.ReadMemory(IntVectorTable + vector)
+	if err != nil {
+		return err
+	}
+	if handler == 0 {
+		return newTraceableError(uint32(c.PC), instr, exceptionError(vector))
+	}
+
+	if err = c.enterSupervisor(pc); err != nil {
+		return err
+	}
+	c.PC = handler
+	return nil
+}
+
+// exceptionError returns the error reported for an exception vector when no
+// handler is installed.
+func exceptionError(vector uint16) error {
+	switch vector {
+	case ExcPrivilege:
+		return ErrPrivilege
+	case ExcIllegalOpcode:
+		return ErrBadOpcode
+	case ExcAccessViolation:
+		return ErrAccessViolation
+	}
+	return ErrNotImplemented
+}
+
+// accessViolation reports whether accessing address is an access control
+// violation. In user mode the system space and device registers are off
+// limits.
+func (c *CPU) accessViolation(address uint16) bool {
+	return c.UserMode && (address <= SystemSpaceEnd || address >= DeviceSpaceStart)
+}
+
+// returnFromInterrupt pops the PC and PSR off the supervisor stack, swapping
+// back to the user stack when returning to user mode. It returns the PC.
+func (c *CPU) returnFromInterrupt() (uint16, error) {
+	pc, err := c.pop()
+	if err != nil {
+		return 0, err
+	}
+	psr, err := c.pop()
+	if err != nil {
+		return 0, err
+	}
+	c.SetPSR(psr)
+	if c.UserMode {
+		c.SavedSSP = c.Reg[6]
+		c.Reg[6] = c.SavedUSP
+	}
+	return pc, nil
+}
+
+// push pushes a value onto the stack pointed to by R6.
+func (c *CPU) push(value uint16) error {
+	c.Reg[6]--
+	return c.WriteMemory(c.Reg[6], value)
+}
+
+// pop pops a value off the stack pointed to by R6.
+func (c *CPU) pop() (uint16, error) {
+	value, err := c.ReadMemory(c.Reg[6])
+	if err != nil {
+		return 0, err
+	}
+	c.Reg[6]++
+	return value, nil
+}
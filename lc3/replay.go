@@ -0,0 +1,88 @@
+package lc3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// InputEvent is a key read by the program, along with the value of Cycles
+// when it was read.
+type InputEvent struct {
+	Cycle uint64 `json:"cycle"`
+	Key   rune   `json:"key"`
+	Trap  bool   `json:"trap,omitempty"` // read by the GETC or IN trap rather than through KBDR
+}
+
+// InputRecorder receives every key the program reads, so that the input can
+// be replayed with ReplayInput.
+type InputRecorder interface {
+	RecordInput(e InputEvent) error
+}
+
+type inputLog struct {
+	enc *json.Encoder
+}
+
+// NewInputLog returns an InputRecorder that writes each event to w as a line
+// of JSON.
+func NewInputLog(w io.Writer) InputRecorder {
+	return &inputLog{enc: json.NewEncoder(w)}
+}
+
+func (l *inputLog) RecordInput(e InputEvent) error {
+	return l.enc.Encode(&e)
+}
+
+// ReadInputLog reads the events written by an input log.
+func ReadInputLog(r io.Reader) ([]InputEvent, error) {
+	var events []InputEvent
+	dec := json.NewDecoder(r)
+	for {
+		var e InputEvent
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, fmt.Errorf("input event %d: %v", len(events)+1, err)
+		}
+		events = append(events, e)
+	}
+}
+
+// ReplayInput makes the keyboard deliver the recorded keys instead of those
+// from the console, each at the instruction where it was originally read, so
+// that the program runs exactly as it did when the input was recorded. Once
+// the events run out the keyboard behaves as if its input was closed. Step
+// returns ErrReplayDiverged if the program does not read a key where it was
+// recorded.
+//
+// Runs only repeat exactly when they start from the same state, and programs
+// that use the timer in millisecond mode will not.
+func (c *CPU) ReplayInput(events []InputEvent) {
+	c.keyboard.replay = events
+	c.keyboard.replayNext = 0
+	c.keyboard.replaying = true
+}
+
+// recordInput passes a key read by the program to the InputRecorder.
+func (c *CPU) recordInput(key rune, trap bool) error {
+	c.recordKey(key)
+	if c.InputRecorder == nil {
+		return nil
+	}
+	if err := c.InputRecorder.RecordInput(InputEvent{Cycle: c.Cycles, Key: key, Trap: trap}); err != nil {
+		return c.fault(err)
+	}
+	return nil
+}
+
+// checkReplay returns an error if the program has missed a replayed key.
+func (c *CPU) checkReplay() error {
+	k := &c.keyboard
+	if k.replaying && k.replayNext < len(k.replay) && k.replay[k.replayNext].Cycle < c.Cycles {
+		return c.fault(ErrReplayDiverged)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package lc3
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const replayProgram = `
+	.ORIG x3000
+POLL	LDI R1, KBSR
+	BRzp POLL
+	LDI R0, KBDR
+	ST R0, FIRST
+	GETC
+	ST R0, SECOND
+	HALT
+FIRST	.FILL 0
+SECOND	.FILL 0
+KBSR	.FILL xFE00
+KBDR	.FILL xFE02
+	.END
+`
+
+func replayCPU(t *testing.T) *CPU {
+	p, err := Assemble("replay.asm", strings.NewReader(replayProgram))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := NewCPU()
+	cpu.Console = NewConsole(strings.NewReader(""), ioutil.Discard)
+	cpu.Load(p)
+	cpu.Reset()
+	return cpu
+}
+
+func TestRecordInput(t *testing.T) {
+	cpu := replayCPU(t)
+	var log bytes.Buffer
+	cpu.InputRecorder = NewInputLog(&log)
+	cpu.PushKey('a')
+	cpu.PushKey('b')
+	if err := cpu.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := ReadInputLog(&log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InputEvent{{Cycle: 0, Key: 'a'}, {Cycle: 3, Key: 'b'}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("recorded %v expected %v", events, want)
+	}
+
+	replayed := replayCPU(t)
+	replayed.ReplayInput(events)
+	if err := replayed.Run(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, replayed, currentState(cpu), "replayed")
+}
+
+func TestReplayInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []InputEvent
+		cycles uint64
+		err    error
+	}{
+		{"read by the trap", []InputEvent{{Cycle: 0, Key: 'a'}, {Cycle: 4, Key: 'b', Trap: true}}, 7, nil},
+		{"trap reads later", []InputEvent{{Cycle: 0, Key: 'a'}, {Cycle: 7, Key: 'b', Trap: true}}, 4, ErrReplayDiverged},
+		{"input runs out", []InputEvent{{Cycle: 0, Key: 'a'}}, 4, ErrNoInput},
+		{"key not read", []InputEvent{{Cycle: 0, Key: 'a', Trap: true}}, 1, ErrReplayDiverged},
+	}
+	for _, tt := range tests {
+		cpu := replayCPU(t)
+		cpu.PushKey('x')
+		cpu.ReplayInput(tt.events)
+		err := cpu.Run()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v expected %v", tt.name, err, tt.err)
+		}
+		if cpu.Cycles != tt.cycles {
+			t.Errorf("%s: ran %d instructions expected %d", tt.name, cpu.Cycles, tt.cycles)
+		}
+		if tt.err == nil && (cpu.Memory[0x3007] != 'a' || cpu.Memory[0x3008] != 'b') {
+			t.Errorf("%s: read x%04X and x%04X expected 'a' and 'b'", tt.name, cpu.Memory[0x3007], cpu.Memory[0x3008])
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package lc3
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+)
+
+// RetrieveROM reads an LC-3 object file and returns a memory image with the
+// program placed at its origin.
+func RetrieveROM(filename string) ([65536]uint16, error) {
+	m := [65536]uint16{}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return m, err
+	}
+	defer file.Close()
+
+	origin, err := ReadROM(file, &m)
+	if err != nil {
+		return m, err
+	}
+	log.Printf("Origin memory location: 0x%04X", origin)
+
+	return m, nil
+}
+
+// ReadROM reads an LC-3 object file from r into the memory image m. Only the
+// words contained in the file are written, so several object files can be
+// loaded into the same image. It returns the origin of the program.
+func ReadROM(r io.Reader, m *[65536]uint16) (origin uint16, err error) {
+	buffer := bufio.NewReader(r)
+
+	// Read origin
+	// The first 16 bits of the program file specify the address in memory where the
+	// program should start. This address is called the origin.
+	// LC-3 programs are big-endian, but most of the modern computers we use are little endian
+	err = binary.Read(buffer, binary.BigEndian, &origin)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := int(origin); i < len(m); i++ {
+		var val uint16
+		err = binary.Read(buffer, binary.BigEndian, &val)
+		if err == io.EOF {
+			return origin, nil
+		}
+		if err != nil {
+			return origin, err
+		}
+		m[i] = val
+	}
+
+	return origin, nil
+}
+
+// ReadObj reads an LC-3 object file into a Program.
+func ReadObj(r io.Reader) (*Program, error) {
+	buffer := bufio.NewReader(r)
+	p := &Program{Symbols: SymbolTable{}}
+	if err := binary.Read(buffer, binary.BigEndian, &p.Origin); err != nil {
+		return nil, err
+	}
+	for int(p.Origin)+len(p.Words) < 0x10000 {
+		var word uint16
+		err := binary.Read(buffer, binary.BigEndian, &word)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.Words = append(p.Words, word)
+	}
+	return p, nil
+}
+
+// LoadROM reads an LC-3 object file into the CPU's memory at its origin,
+// leaving the rest of memory untouched.
+func (c *CPU) LoadROM(filename string) (uint16, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return ReadROM(file, &c.Memory)
+}
+
+// Edition is the edition of Patt and Patel's textbook whose LC-3 an operating
+// system was written for, which decides how TRAP calls its service routines.
+type Edition int
+
+const (
+	// SecondEdition traps save the return address in R7 and leave the
+	// privilege mode unchanged, so service routines return with RET. The
+	// standard lc3os follows the 2nd edition.
+	SecondEdition Edition = iota
+
+	// ThirdEdition traps enter supervisor mode and push the PSR and return
+	// address onto the supervisor stack, so service routines return with RTI.
+	ThirdEdition
+)
+
+// trapCalls reports whether TRAP calls the operating system's service
+// routines like subroutines, returning with RET.
+func (c *CPU) trapCalls() bool {
+	return c.osLoaded && c.OSEdition == SecondEdition
+}
+
+// LoadOS reads an LC-3 operating system image into memory. Once an OS is
+// loaded, TRAP instructions jump to the service routines listed in its trap
+// vector table instead of using the built-in routines, calling them as
+// OSEdition describes.
+func (c *CPU) LoadOS(filename string) error {
+	if _, err := c.LoadROM(filename); err != nil {
+		return err
+	}
+	c.osLoaded = true
+	return nil
+}
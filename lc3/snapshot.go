@@ -0,0 +1,144 @@
+package lc3
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// snapshotMagic starts a snapshot, followed by the format version.
+const (
+	snapshotMagic   = "LC3SNAPS"
+	snapshotVersion = 1
+)
+
+// snapshotState is the fixed size part of a snapshot.
+type snapshotState struct {
+	Reg                [8]uint16
+	PC, PSR            uint16
+	SavedSSP, SavedUSP uint16
+	Cycles             uint64
+	RunState           uint8
+	OSLoaded           bool
+	KBSR, KBDR         uint16
+	DSR, DDR           uint16
+	DisplayBusy        int32
+	TCR, TIR, TSR      uint16
+	TimerCount         uint16
+	TimerStarted       bool
+	MCR                uint16
+	KeyCount           uint32
+}
+
+// SaveSnapshot writes the state of the machine to w, so that LoadSnapshot can
+// resume execution where it left off. The CPU must not be running.
+//
+// A snapshot starts with the magic string "LC3SNAPS" and a 16-bit version
+// number. It then holds, as big-endian integers, the registers, PC, PSR,
+// saved stack pointers, cycle count, run state, whether an operating system
+// is loaded, the keyboard, display, timer and machine control registers along
+// with the display and timer counters, and the number of keys waiting in the
+// keyboard queue. The waiting keys follow as 32-bit values, and finally all
+// 65536 words of memory. Devices added with Attach are not saved.
+func (c *CPU) SaveSnapshot(w io.Writer) error {
+	keys := c.keyboard.queue.waiting()
+	state := snapshotState{
+		Reg:          c.Reg,
+		PC:           c.PC,
+		PSR:          c.PSR(),
+		SavedSSP:     c.SavedSSP,
+		SavedUSP:     c.SavedUSP,
+		Cycles:       c.Cycles,
+		RunState:     uint8(c.State()),
+		OSLoaded:     c.osLoaded,
+		KBSR:         c.keyboard.status,
+		KBDR:         c.keyboard.data,
+		DSR:          c.display.status,
+		DDR:          c.display.data,
+		DisplayBusy:  int32(c.display.busy),
+		TCR:          c.timer.control,
+		TIR:          c.timer.interval,
+		TSR:          c.timer.status,
+		TimerCount:   c.timer.count,
+		TimerStarted: c.timer.started,
+		MCR:          c.mcr.value,
+		KeyCount:     uint32(len(keys)),
+	}
+
+	buffer := bufio.NewWriter(w)
+	buffer.WriteString(snapshotMagic)
+	binary.Write(buffer, binary.BigEndian, uint16(snapshotVersion))
+	binary.Write(buffer, binary.BigEndian, &state)
+	binary.Write(buffer, binary.BigEndian, []int32(keys))
+	binary.Write(buffer, binary.BigEndian, &c.Memory)
+	return buffer.Flush()
+}
+
+// LoadSnapshot restores the state of the machine from a snapshot written by
+// SaveSnapshot. The CPU is left untouched if the snapshot cannot be read. A
+// machine that was running when the snapshot was taken is restored stopped,
+// ready to Run, and any History is cleared.
+func (c *CPU) LoadSnapshot(r io.Reader) error {
+	buffer := bufio.NewReader(r)
+	var header struct {
+		Magic   [8]byte
+		Version uint16
+	}
+	if err := binary.Read(buffer, binary.BigEndian, &header); err != nil {
+		return truncated(err)
+	}
+	if string(header.Magic[:]) != snapshotMagic {
+		return ErrBadSnapshot
+	}
+	if header.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+
+	var state snapshotState
+	if err := binary.Read(buffer, binary.BigEndian, &state); err != nil {
+		return truncated(err)
+	}
+	if state.KeyCount > 1<<20 {
+		return fmt.Errorf("snapshot has %d keys waiting", state.KeyCount)
+	}
+	keys := make([]int32, state.KeyCount)
+	if err := binary.Read(buffer, binary.BigEndian, keys); err != nil {
+		return truncated(err)
+	}
+	memory := new([65536]uint16)
+	if err := binary.Read(buffer, binary.BigEndian, memory); err != nil {
+		return truncated(err)
+	}
+
+	if c.History != nil {
+		c.History.reset(state.Cycles)
+	}
+	if c.CondRegister == nil {
+		c.CondRegister = &CondRegister{}
+	}
+	c.Reg = state.Reg
+	c.PC = state.PC
+	c.SetPSR(state.PSR)
+	c.SavedSSP, c.SavedUSP = state.SavedSSP, state.SavedUSP
+	c.Cycles = state.Cycles
+	c.osLoaded = state.OSLoaded
+	c.prompted = false
+	c.keyboard.status, c.keyboard.data = state.KBSR, state.KBDR
+	c.keyboard.queue.replace([]rune(keys))
+	c.display.status, c.display.data, c.display.busy = state.DSR, state.DDR, int(state.DisplayBusy)
+	c.timer = timer{
+		control: state.TCR, interval: state.TIR, status: state.TSR,
+		count: state.TimerCount, started: state.TimerStarted, start: time.Now(),
+	}
+	c.mcr.value = state.MCR
+	c.Memory = *memory
+
+	runState := RunState(state.RunState)
+	if runState != RunStateHalted {
+		runState = RunStateStopped
+	}
+	c.setState(runState)
+	return nil
+}
@@ -0,0 +1,90 @@
+package lc3
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	cpu := historyCPU(t, 100, 0)
+	cpu.PushKey('z')
+	cpu.start()
+	for i := 0; i < 10; i++ {
+		if err := cpu.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cpu.Stop()
+
+	var b bytes.Buffer
+	if err := cpu.SaveSnapshot(&b); err != nil {
+		t.Fatal(err)
+	}
+	saved := b.Bytes()
+
+	restored := NewCPU()
+	restored.Console = NewConsole(strings.NewReader(""), ioutil.Discard)
+	if err := restored.LoadSnapshot(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, restored, currentState(cpu), "restored")
+	if restored.keyboard.data != 'k' || string(restored.keyboard.queue.waiting()) != "z" || restored.State() != RunStateStopped {
+		t.Errorf("restored KBDR x%04X, keys %q and state %d expected 'k', \"z\" and %d",
+			restored.keyboard.data, string(restored.keyboard.queue.waiting()), restored.State(), RunStateStopped)
+	}
+
+	// both machines finish the same way
+	if err := cpu.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Run(); err != nil {
+		t.Fatal(err)
+	}
+	checkState(t, restored, currentState(cpu), "finished")
+
+	// a halted machine stays halted
+	b.Reset()
+	if err := cpu.SaveSnapshot(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.LoadSnapshot(&b); err != nil || restored.State() != RunStateHalted {
+		t.Errorf("restored halted machine with state %d, %v", restored.State(), err)
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	cpu := historyCPU(t, 100, 0)
+	var b bytes.Buffer
+	if err := cpu.SaveSnapshot(&b); err != nil {
+		t.Fatal(err)
+	}
+	saved := b.Bytes()
+
+	newer := append([]byte{}, saved...)
+	newer[len(snapshotMagic)+1] = 2
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"not a snapshot", []byte("LC3TRACE\x00\x01"), ErrBadSnapshot.Error()},
+		{"newer version", newer, "unsupported snapshot version 2"},
+		{"truncated", saved[:len(saved)-1], io.ErrUnexpectedEOF.Error()},
+		{"empty", nil, io.ErrUnexpectedEOF.Error()},
+	}
+	for _, tt := range tests {
+		restored := NewCPU()
+		restored.PC = 0x1234
+		err := restored.LoadSnapshot(bytes.NewReader(tt.data))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%s: got error %v expected %s", tt.name, err, tt.err)
+		}
+		if restored.PC != 0x1234 {
+			t.Errorf("%s: the CPU was changed", tt.name)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package lc3
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SymbolTable maps the labels of a program to their addresses.
+type SymbolTable map[string]uint16
+
+// ReadSymbols reads a symbol table in the format written by lc3as, where
+// each symbol is listed on a comment line as its name followed by its
+// address in hexadecimal:
+//
+//	// Symbol table
+//	// Scope level 0:
+//	//	Symbol Name       Page Address
+//	//	----------------  ------------
+//	//	LOOP              3002
+func ReadSymbols(r io.Reader) (SymbolTable, error) {
+	symbols := SymbolTable{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "//"))
+		if len(fields) != 2 {
+			continue
+		}
+		address, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(fields[1]), "x"), 16, 16)
+		if err != nil {
+			// skip the headings
+			continue
+		}
+		symbols[fields[0]] = uint16(address)
+	}
+	return symbols, scanner.Err()
+}
+
+// LoadSymbols reads a symbol table file.
+func LoadSymbols(filename string) (SymbolTable, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadSymbols(file)
+}
+
+// Label returns the label at address, if there is one. When several labels
+// share an address the first in alphabetical order is returned.
+func (s SymbolTable) Label(address uint16) (string, bool) {
+	var label string
+	for name, a := range s {
+		if a == address && (label == "" || name < label) {
+			label = name
+		}
+	}
+	return label, label != ""
+}
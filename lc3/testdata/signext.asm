@@ -0,0 +1,23 @@
+; Exercises sign extension of immediates and offsets, and indirect stores.
+        .ORIG x3000
+        AND R0, R0, #0
+        ADD R0, R0, #-16    ; the most negative imm5
+        ADD R1, R0, #15     ; the most positive imm5
+        LEA R2, DATA
+        LDR R3, R2, #-1     ; negative offset6
+        NOT R4, R3
+        STI R0, PTR         ; indirect store through PTR
+        LDI R5, PTR
+        AND R6, R6, #0      ; the simulators' initial R6 differs
+        ADD R6, R6, #-2
+        BRn BACK
+FWD     JSR SUB
+        HALT
+BACK    BRnzp FWD           ; negative PCoffset9
+SUB     AND R7, R7, R7
+        RET
+VALUE   .FILL x8000
+DATA    .FILL x1234
+PTR     .FILL STORE
+STORE   .BLKW 1
+        .END
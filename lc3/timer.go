@@ -0,0 +1,101 @@
+package lc3
+
+import "time"
+
+// Timer control register bits
+const (
+	tcrEnable       uint16 = 0x8000 // TCR[15], set to start the timer
+	tcrIntEnable    uint16 = 0x4000 // TCR[14], set to enable timer interrupts
+	tcrMilliseconds uint16 = 0x2000 // TCR[13], count milliseconds instead of instructions
+	tcrPriority     uint16 = 0x0700 // TCR[10:8], priority level of timer interrupts
+)
+
+// Timer status register bits
+const (
+	tsrExpired uint16 = 0x8000 // TSR[15], set each time the interval elapses
+)
+
+// timer is a programmable interval timer. Once enabled it sets the expired
+// bit of TSR every TIR instructions, or every TIR milliseconds, and can
+// request an interrupt at the priority set in TCR. Reading TSR clears the
+// expired bit.
+type timer struct {
+	control  uint16    // TCR
+	interval uint16    // TIR
+	status   uint16    // TSR
+	count    uint16    // instructions since the interval last elapsed
+	started  bool      // set while the timer is counting
+	start    time.Time // when the current interval started in millisecond mode
+}
+
+func (t *timer) Read(address uint16) (uint16, error) {
+	switch address {
+	case MemRegTCR:
+		return t.control, nil
+	case MemRegTIR:
+		return t.interval, nil
+	case MemRegTSR:
+		// reading the status register acknowledges the timer
+		status := t.status
+		t.status &^= tsrExpired
+		return status, nil
+	}
+	return 0, nil
+}
+
+func (t *timer) Write(address uint16, value uint16) error {
+	switch address {
+	case MemRegTCR:
+		t.control = value
+	case MemRegTIR:
+		t.interval = value
+	case MemRegTSR:
+		t.status = value & tsrExpired
+		return nil
+	default:
+		return nil
+	}
+
+	// changing the control or interval registers restarts the timer
+	t.started = false
+	return nil
+}
+
+// Tick advances the timer by one instruction.
+func (t *timer) Tick() error {
+	if t.control&tcrEnable == 0 || t.interval == 0 {
+		t.started = false
+		return nil
+	}
+
+	if !t.started {
+		t.started = true
+		t.count = 0
+		t.start = time.Now()
+	}
+
+	if t.control&tcrMilliseconds != 0 {
+		period := time.Duration(t.interval) * time.Millisecond
+		if elapsed := time.Since(t.start); elapsed >= period {
+			t.start = t.start.Add(elapsed / period * period)
+			t.status |= tsrExpired
+		}
+		return nil
+	}
+
+	t.count++
+	if t.count >= t.interval {
+		t.count = 0
+		t.status |= tsrExpired
+	}
+	return nil
+}
+
+// Interrupt requests a timer interrupt while the interval has elapsed and
+// interrupts are enabled.
+func (t *timer) Interrupt() (Interrupt, bool) {
+	if t.status&tsrExpired != 0 && t.control&tcrIntEnable != 0 {
+		return Interrupt{Vector: IntTimer, Priority: (t.control & tcrPriority) >> 8}, true
+	}
+	return Interrupt{}, false
+}
@@ -0,0 +1,297 @@
+package lc3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Tracer receives a record of every instruction the CPU executes.
+type Tracer interface {
+	Trace(rec *TraceRecord) error
+}
+
+// TraceRecord describes the effects of executing a single instruction.
+type TraceRecord struct {
+	Cycle  uint64        // value of Cycles before the instruction executed
+	PC     uint16        // address of the instruction
+	Instr  uint16        // the instruction
+	Regs   []RegWrite    // registers written
+	Reads  []MemoryTrace // memory read, not including the instruction fetch
+	Writes []MemoryTrace // memory written
+	PSR    uint16        // the PSR after the instruction, holding the condition codes
+
+	registersOnly bool // from a register dump, so without memory accesses or a full PSR
+}
+
+// RegWrite records a value written to a general purpose register.
+type RegWrite struct {
+	Reg   uint8  `json:"reg"`
+	Value uint16 `json:"value"`
+}
+
+// MemoryTrace records a memory access.
+type MemoryTrace struct {
+	Addr  uint16 `json:"addr"`
+	Value uint16 `json:"value"`
+}
+
+// CC returns the condition codes set after the instruction as N, Z or P.
+func (rec *TraceRecord) CC() string {
+	switch {
+	case rec.PSR&psrN != 0:
+		return "N"
+	case rec.PSR&psrZ != 0:
+		return "Z"
+	case rec.PSR&psrP != 0:
+		return "P"
+	}
+	return ""
+}
+
+// startTrace begins recording the effects of the next instruction.
+func (c *CPU) startTrace() {
+	if c.Tracer == nil {
+		return
+	}
+	c.trace = &TraceRecord{Cycle: c.Cycles}
+	c.traceRegs = c.Reg
+}
+
+// finishTrace passes the record of the executed instruction to the tracer.
+func (c *CPU) finishTrace() error {
+	rec := c.trace
+	c.trace = nil
+	if rec == nil {
+		return nil
+	}
+
+	dest, hasDest := destRegister(rec.Instr, c.osLoaded, c.OSEdition)
+	for r := range c.Reg {
+		if c.Reg[r] != c.traceRegs[r] || (hasDest && uint16(r) == dest) {
+			rec.Regs = append(rec.Regs, RegWrite{Reg: uint8(r), Value: c.Reg[r]})
+		}
+	}
+	rec.PSR = c.PSR()
+
+	if err := c.Tracer.Trace(rec); err != nil {
+		return c.fault(err)
+	}
+	return nil
+}
+
+// traceRead records a memory read made by the instruction being traced.
+func (c *CPU) traceRead(address, value uint16) {
+	if c.trace != nil {
+		c.trace.Reads = append(c.trace.Reads, MemoryTrace{Addr: address, Value: value})
+	}
+}
+
+// traceWrite records a memory write made by the instruction being traced.
+func (c *CPU) traceWrite(address, value uint16) {
+	if c.trace != nil {
+		c.trace.Writes = append(c.trace.Writes, MemoryTrace{Addr: address, Value: value})
+	}
+}
+
+// destRegister returns the register an instruction always writes, so that
+// writes are traced even when the value does not change. A trap into an
+// operating system writes R7 only in the 2nd edition.
+func destRegister(instr uint16, osLoaded bool, edition Edition) (uint16, bool) {
+	switch instr >> 12 {
+	case OpADD, OpAND, OpNOT, OpLD, OpLDI, OpLDR, OpLEA:
+		return extract1C(instr, 11, 9), true
+	case OpJSR:
+		return 7, true
+	case OpTRAP:
+		if osLoaded {
+			return 7, edition == SecondEdition
+		}
+		if vector := instr & 0xFF; vector == TrapGETC || vector == TrapIN {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// jsonTraceRecord is the JSON Lines form of a TraceRecord.
+type jsonTraceRecord struct {
+	Cycle  uint64        `json:"cycle"`
+	PC     uint16        `json:"pc"`
+	Instr  uint16        `json:"instr"`
+	Asm    string        `json:"asm"`
+	Regs   []RegWrite    `json:"regs,omitempty"`
+	Reads  []MemoryTrace `json:"reads,omitempty"`
+	Writes []MemoryTrace `json:"writes,omitempty"`
+	CC     string        `json:"cc"`
+	PSR    uint16        `json:"psr"`
+}
+
+type jsonTracer struct {
+	enc *json.Encoder
+}
+
+// NewJSONTracer returns a Tracer that writes each record to w as a line of
+// JSON, including the disassembly of the instruction. Values are written as
+// decimal numbers.
+func NewJSONTracer(w io.Writer) Tracer {
+	return &jsonTracer{enc: json.NewEncoder(w)}
+}
+
+func (t *jsonTracer) Trace(rec *TraceRecord) error {
+	return t.enc.Encode(&jsonTraceRecord{
+		Cycle:  rec.Cycle,
+		PC:     rec.PC,
+		Instr:  rec.Instr,
+		Asm:    Disassemble(rec.PC, rec.Instr),
+		Regs:   rec.Regs,
+		Reads:  rec.Reads,
+		Writes: rec.Writes,
+		CC:     rec.CC(),
+		PSR:    rec.PSR,
+	})
+}
+
+// binaryTraceMagic starts a binary trace, followed by the format version.
+const (
+	binaryTraceMagic   = "LC3TRACE"
+	binaryTraceVersion = 1
+)
+
+type binaryTracer struct {
+	w       io.Writer
+	started bool
+	buf     bytes.Buffer
+}
+
+// NewBinaryTracer returns a Tracer that writes records to w in a compact
+// binary format. The trace starts with the magic string "LC3TRACE" and a
+// 16-bit version number. Each record then holds, as big-endian integers,
+// the 64-bit cycle, the PC, instruction and PSR, and then the registers
+// written, the memory reads and the memory writes, each as an 8-bit count
+// followed by register number and value or address and value pairs.
+func NewBinaryTracer(w io.Writer) Tracer {
+	return &binaryTracer{w: w}
+}
+
+func (t *binaryTracer) Trace(rec *TraceRecord) error {
+	t.buf.Reset()
+	if !t.started {
+		t.buf.WriteString(binaryTraceMagic)
+		binary.Write(&t.buf, binary.BigEndian, uint16(binaryTraceVersion))
+		t.started = true
+	}
+
+	binary.Write(&t.buf, binary.BigEndian, rec.Cycle)
+	binary.Write(&t.buf, binary.BigEndian, []uint16{rec.PC, rec.Instr, rec.PSR})
+	t.buf.WriteByte(uint8(len(rec.Regs)))
+	for _, r := range rec.Regs {
+		t.buf.WriteByte(r.Reg)
+		binary.Write(&t.buf, binary.BigEndian, r.Value)
+	}
+	for _, accesses := range [][]MemoryTrace{rec.Reads, rec.Writes} {
+		t.buf.WriteByte(uint8(len(accesses)))
+		for _, m := range accesses {
+			binary.Write(&t.buf, binary.BigEndian, []uint16{m.Addr, m.Value})
+		}
+	}
+
+	_, err := t.w.Write(t.buf.Bytes())
+	return err
+}
+
+// ReadTrace reads a trace written by either of the tracers, detecting the
+// format from its contents.
+func ReadTrace(r io.Reader) ([]TraceRecord, error) {
+	buffer := bufio.NewReader(r)
+	magic, err := buffer.Peek(len(binaryTraceMagic))
+	if err == nil && string(magic) == binaryTraceMagic {
+		return readBinaryTrace(buffer)
+	}
+	return readJSONTrace(buffer)
+}
+
+func readJSONTrace(r io.Reader) ([]TraceRecord, error) {
+	var records []TraceRecord
+	dec := json.NewDecoder(r)
+	for {
+		var j jsonTraceRecord
+		err := dec.Decode(&j)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("trace record %d: %v", len(records)+1, err)
+		}
+		records = append(records, TraceRecord{
+			Cycle: j.Cycle, PC: j.PC, Instr: j.Instr, Regs: j.Regs, Reads: j.Reads, Writes: j.Writes, PSR: j.PSR,
+		})
+	}
+}
+
+func readBinaryTrace(r *bufio.Reader) ([]TraceRecord, error) {
+	var header struct {
+		Magic   [8]byte
+		Version uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Version != binaryTraceVersion {
+		return nil, fmt.Errorf("unsupported trace version %d", header.Version)
+	}
+
+	var records []TraceRecord
+	for {
+		var rec TraceRecord
+		var fixed struct {
+			Cycle          uint64
+			PC, Instr, PSR uint16
+			RegCount       uint8
+		}
+		err := binary.Read(r, binary.BigEndian, &fixed)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, truncated(err)
+		}
+		rec.Cycle, rec.PC, rec.Instr, rec.PSR = fixed.Cycle, fixed.PC, fixed.Instr, fixed.PSR
+
+		for i := 0; i < int(fixed.RegCount); i++ {
+			var w struct {
+				Reg   uint8
+				Value uint16
+			}
+			if err := binary.Read(r, binary.BigEndian, &w); err != nil {
+				return records, truncated(err)
+			}
+			rec.Regs = append(rec.Regs, RegWrite{Reg: w.Reg, Value: w.Value})
+		}
+		for _, accesses := range []*[]MemoryTrace{&rec.Reads, &rec.Writes} {
+			count, err := r.ReadByte()
+			if err != nil {
+				return records, truncated(err)
+			}
+			for i := 0; i < int(count); i++ {
+				var m MemoryTrace
+				if err := binary.Read(r, binary.BigEndian, &m); err != nil {
+					return records, truncated(err)
+				}
+				*accesses = append(*accesses, m)
+			}
+		}
+		records = append(records, rec)
+	}
+}
+
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
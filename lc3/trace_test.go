@@ -0,0 +1,67 @@
+package lc3
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func traceProgram(t *testing.T, tracer Tracer) {
+	m := [65536]uint16{}
+	m[0x3000] = 0x5020 // AND R0, R0, #0
+	m[0x3001] = 0x1025 // ADD R0, R0, #5
+	m[0x3002] = 0x3002 // ST R0, x3005
+	m[0x3003] = 0x2201 // LD R1, x3005
+	m[0x3004] = 0xF025 // HALT
+
+	cpu := initCPU(m)
+	cpu.Tracer = tracer
+	if err := cpu.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	var out bytes.Buffer
+	traceProgram(t, NewJSONTracer(&out))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		`{"cycle":0,"pc":12288,"instr":20512,"asm":"AND R0, R0, #0","regs":[{"reg":0,"value":0}],"cc":"Z","psr":2}`,
+		`{"cycle":1,"pc":12289,"instr":4133,"asm":"ADD R0, R0, #5","regs":[{"reg":0,"value":5}],"cc":"P","psr":1}`,
+		`{"cycle":2,"pc":12290,"instr":12290,"asm":"ST R0, x3005","writes":[{"addr":12293,"value":5}],"cc":"P","psr":1}`,
+		`{"cycle":3,"pc":12291,"instr":8705,"asm":"LD R1, x3005","regs":[{"reg":1,"value":5}],"reads":[{"addr":12293,"value":5}],"cc":"P","psr":1}`,
+		`{"cycle":4,"pc":12292,"instr":61477,"asm":"HALT","cc":"P","psr":1}`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("traced %d instructions expected %d:\n%s", len(lines), len(want), out.String())
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("record %d:\n%s\nexpected:\n%s", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestBinaryTracer(t *testing.T) {
+	var jsonOut, binaryOut bytes.Buffer
+	traceProgram(t, NewJSONTracer(&jsonOut))
+	traceProgram(t, NewBinaryTracer(&binaryOut))
+
+	if binaryOut.Len() >= jsonOut.Len() {
+		t.Errorf("binary trace is %d bytes, JSON trace is %d", binaryOut.Len(), jsonOut.Len())
+	}
+
+	fromJSON, err := ReadTrace(&jsonOut)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fromBinary, err := ReadTrace(&binaryOut)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fromBinary) != 5 || !reflect.DeepEqual(fromJSON, fromBinary) {
+		t.Errorf("binary trace %v expected %v", fromBinary, fromJSON)
+	}
+}
@@ -0,0 +1,115 @@
+package lc3
+
+import "log"
+
+// trapInPrompt is the prompt printed by the IN trap, matching the LC-3 OS.
+const trapInPrompt = "\nInput a character> "
+
+// emulateTrap runs the built-in service routine for a TRAP instruction. It
+// returns false when the routine is still waiting for a key press.
+func (c *CPU) emulateTrap(instr uint16) (done bool, err error) {
+	trapCode := instr & 0xFF
+	switch trapCode {
+	case TrapGETC:
+		var key uint16
+		key, done, err = c.readKey()
+		if !done || err != nil {
+			return
+		}
+		c.Reg[0] = key
+	case TrapOUT:
+		err = c.writeChar(c.Reg[0])
+	case TrapPUTS:
+		address := c.Reg[0]
+		for i := uint16(0); c.Memory[address+i] != 0x0; i++ {
+			if err = c.writeChar(c.Memory[address+i]); err != nil {
+				return
+			}
+		}
+	case TrapIN:
+		// prompt for a character, then echo it back followed by a newline.
+		// A trap retried while it waits for the key prompts only once.
+		if !c.prompted {
+			for _, chr := range trapInPrompt {
+				if err = c.writeChar(uint16(chr)); err != nil {
+					return
+				}
+			}
+			c.prompted = true
+		}
+		var key uint16
+		key, done, err = c.readKey()
+		if !done || err != nil {
+			return
+		}
+		c.prompted = false
+		c.Reg[0] = key
+		if err = c.writeChar(key); err != nil {
+			return
+		}
+		err = c.writeChar('\n')
+	case TrapPUTSP:
+		// each word holds two characters, low byte first. Like the LC-3 OS,
+		// printing ends at the first zero byte.
+		for address := c.Reg[0]; ; address++ {
+			word := c.Memory[address]
+			if word&0xFF == 0 {
+				break
+			}
+			if err = c.writeChar(word & 0xFF); err != nil {
+				return
+			}
+			if word>>8 == 0 {
+				break
+			}
+			if err = c.writeChar(word >> 8); err != nil {
+				return
+			}
+		}
+	case TrapHALT:
+		if c.DebugMode {
+			log.Println("HALT")
+		}
+		// stop the clock
+		c.mcr.value &^= mcrClockEnable
+	default:
+		return false, c.fault(ErrBadTrap)
+	}
+	return true, err
+}
+
+// readKey returns the next key press for the GETC and IN traps. It blocks
+// until a key is available, returning false if the CPU is stopped first.
+func (c *CPU) readKey() (key uint16, ok bool, err error) {
+	// use the key waiting in the keyboard data register if there is one
+	kbsr, err := c.ReadMemory(MemRegKBSR)
+	if err != nil {
+		return 0, false, err
+	}
+	if kbsr&kbsrReady != 0 {
+		key, err = c.ReadMemory(MemRegKBDR)
+		return key, err == nil, err
+	}
+
+	// block until a key is pressed
+	for {
+		if k, ok := c.keyboard.next(c.Cycles, true); ok {
+			return uint16(k), true, c.recordInput(k, true)
+		}
+		if c.keyboard.replaying {
+			if c.keyboard.replayNext == len(c.keyboard.replay) {
+				return 0, false, c.fault(ErrNoInput)
+			}
+			// the recorded trap read its key here, since waiting does not
+			// advance the cycle count
+			return 0, false, c.fault(ErrReplayDiverged)
+		}
+		if c.keyboard.queue.exhausted() {
+			return 0, false, c.fault(ErrNoInput)
+		}
+		if c.State() != RunStateRunning {
+			return 0, false, nil
+		}
+		c.keyboard.queue.wait(nil)
+	}
+}
@@ -1,29 +1,64 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"flag"
 	"log"
-	"math"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
+	"strings"
 
 	"github.com/nsf/termbox-go"
+	"github.com/robmorgan/go-lc3-vm/lc3"
 )
 
 func main() {
-	err := termbox.Init()
-	if err != nil {
-		panic(err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "asm":
+			os.Exit(runAssembler(os.Args[2:]))
+		case "disasm":
+			os.Exit(runDisassembler(os.Args[2:]))
+		}
 	}
-	defer termbox.Close()
 
 	// parse flags
 	debugPtr := flag.Bool("debug", false, "enable debug mode")
 	cpuProfile := flag.String("cpuprofile", "", "write cpu profile to `file`")
+	headless := flag.Bool("headless", false, "run without a terminal UI, reading keys from stdin and writing output to stdout")
+	inputPath := flag.String("input", "", "read headless keyboard input from `file` instead of stdin")
+	osPath := flag.String("os", "", "load an LC-3 operating system image from `file` and use its trap routines")
+	osEdition := flag.Int("os-edition", 2, "call the OS trap routines as the LC-3 of textbook `edition` 2 (return with RET) or 3 (return with RTI) does")
+	displayDelay := flag.Int("display-delay", 0, "number of instructions before the display is ready for another character")
+	timeout := flag.Duration("timeout", 0, "stop a headless run after `duration` (0 means no limit)")
+	debugger := flag.Bool("debugger", false, "run the program under the interactive debugger")
+	gdbAddr := flag.String("gdb", "", "wait for a GDB remote protocol connection on `address`, e.g. :1234")
+	historySize := flag.Int("history", lc3.DefaultHistorySize, "record the last `n` instructions for reverse execution in the debugger and GDB stub, 0 to disable")
+	dapAddr := flag.String("dap", "", "serve the Debug Adapter Protocol on `address`, or on stdin and stdout if set to stdio")
+	tracePath := flag.String("trace", "", "write a trace of every instruction executed to `file`")
+	traceFormat := flag.String("trace-format", "jsonl", "write the trace as `format` jsonl or binary")
+	comparePath := flag.String("compare-trace", "", "compare the execution with the reference trace in `file` and report the first difference")
+	compareFormat := flag.String("compare-format", "trace", "read the reference trace as `format` trace, as written by -trace, or lc3sim, the output of lc3sim's step command")
+	recordInputPath := flag.String("record-input", "", "record each key the program reads, and when, to `file`")
+	replayInputPath := flag.String("replay-input", "", "replay the keys recorded in `file` instead of reading the keyboard")
+	restorePath := flag.String("restore", "", "resume execution from the snapshot in `file`")
+	snapshotPath := flag.String("snapshot", "lc3.snap", "write snapshots taken with F2 or the debugger's save command to `file`")
+	symPath := flag.String("sym", "", "read program labels from the symbol table `file` (defaults to the program's .sym file)")
 	flag.Parse()
 
+	// the debug adapter launches the program requested by the client
+	if *dapAddr != "" {
+		os.Exit(runDAP(*dapAddr))
+	}
+
+	if !*headless && !*debugger && *gdbAddr == "" && *comparePath == "" {
+		err := termbox.Init()
+		if err != nil {
+			panic(err)
+		}
+		defer termbox.Close()
+	}
+
 	// enable the profiler
 	if *cpuProfile != "" {
 		f, err := os.Create(*cpuProfile)
@@ -39,108 +74,195 @@ func main() {
 
 	// load the program file
 	path := getPath()
-	if len(path) == 0 {
+	if len(path) == 0 && *restorePath == "" {
 		log.Fatalln("No program file specified or found")
 	}
-	log.Printf("Loading Program: %s", path)
-
-	// read the program file into a buffer
-	mem, err := RetrieveROM(path)
-	if err != nil {
-		panic(err)
-	}
 
 	// init the CPU
 	log.Println("Boot VM")
-	termbox.Flush()
-	cpu := NewCPU()
+	cpu := lc3.NewCPU()
 	if *debugPtr {
 		log.Printf("Enabling debug mode")
 		cpu.DebugMode = true
 	}
+	cpu.DisplayDelay = *displayDelay
 
-	// init memory
-	cpu.Memory = mem
+	// trace the execution
+	closeTrace := func() error { return nil }
+	if *tracePath != "" {
+		var err error
+		if cpu.Tracer, closeTrace, err = openTrace(*tracePath, *traceFormat); err != nil {
+			log.Fatalln(err)
+		}
+	}
 
-	// init the input loop
-	go processInput(cpu)
+	// record the keys read by the program
+	closeInputLog := func() error { return nil }
+	if *recordInputPath != "" {
+		var err error
+		if cpu.InputRecorder, closeInputLog, err = openInputLog(*recordInputPath); err != nil {
+			log.Fatalln(err)
+		}
+	}
 
-	// reset the CPU and start execution
-	cpu.Reset()
-	cpu.Run()
-	log.Println("Terminating VM")
-}
+	// exit flushes the trace, input log and profile, since deferred calls do
+	// not run
+	exit := func(status int) {
+		if err := closeTrace(); err != nil {
+			log.Printf("could not write trace: %v", err)
+		}
+		if err := closeInputLog(); err != nil {
+			log.Printf("could not write input log: %v", err)
+		}
+		pprof.StopCPUProfile()
+		os.Exit(status)
+	}
 
-func getPath() string {
-	var arg string
-	args := flag.Args()
-	if len(args) > 0 {
-		arg = args[0]
+	// load the operating system and program into memory
+	switch *osEdition {
+	case 2:
+		cpu.OSEdition = lc3.SecondEdition
+	case 3:
+		cpu.OSEdition = lc3.ThirdEdition
+	default:
+		log.Fatalf("unknown LC-3 edition %d, expected 2 or 3", *osEdition)
+	}
+	if *osPath != "" {
+		log.Printf("Loading OS: %s", *osPath)
+		if err := cpu.LoadOS(*osPath); err != nil {
+			panic(err)
+		}
+	}
+	var symbols lc3.SymbolTable
+	if path != "" {
+		log.Printf("Loading Program: %s", path)
+		origin, programSymbols, err := loadProgram(cpu, path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Origin memory location: 0x%04X", origin)
+		symbols = programSymbols
 	}
 
-	info, err := os.Stat(arg)
-	if err != nil {
-		return ""
+	// reset the CPU, or resume from a snapshot
+	cpu.Reset()
+	if *restorePath != "" {
+		log.Printf("Restoring Snapshot: %s", *restorePath)
+		if err := restoreSnapshot(cpu, *restorePath); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if *replayInputPath != "" {
+		events, err := loadInputLog(*replayInputPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		cpu.ReplayInput(events)
 	}
 
-	if info.IsDir() {
-		log.Fatalln("A program file must be specified")
+	if *comparePath != "" {
+		exit(runCompare(cpu, *comparePath, *compareFormat, *inputPath))
 	}
 
-	return arg
-}
+	if (*gdbAddr != "" || *debugger) && *historySize > 0 {
+		cpu.History = lc3.NewHistory(*historySize, lc3.DefaultCheckpointInterval)
+	}
 
-func RetrieveROM(filename string) ([65536]uint16, error) {
-	m := [65536]uint16{}
+	if *gdbAddr != "" {
+		exit(runGDB(cpu, *gdbAddr, *inputPath))
+	}
 
-	file, err := os.Open(filename)
+	if *debugger {
+		if symbols == nil || *symPath != "" {
+			symbols = loadSymbols(path, *symPath)
+		}
+		exit(runDebugger(cpu, symbols, os.Stdin, os.Stdout, *inputPath, *snapshotPath))
+	}
 
-	if err != nil {
-		return m, err
+	if *headless {
+		exit(runHeadless(cpu, *inputPath, *timeout))
 	}
-	defer file.Close()
 
-	stats, statsErr := file.Stat()
-	if statsErr != nil {
-		return m, statsErr
+	// init the console and input loop
+	termbox.Flush()
+	console := &termboxConsole{cpu: cpu}
+	cpu.Console = console
+	go cpu.ReadConsole()
+
+	// start execution, pausing to take any snapshots requested. A program
+	// restored from a snapshot taken after it halted is not run again.
+	for cpu.State() != lc3.RunStateHalted {
+		err := cpu.Run()
+		if err != nil || cpu.State() != lc3.RunStateStopped || !console.takeSaveRequest() {
+			break
+		}
+		if err := saveSnapshot(cpu, *snapshotPath); err != nil {
+			log.Printf("could not save snapshot: %v", err)
+		}
+	}
+	if cpu.DebugMode && console.quitRequested() {
+		logDebugState(cpu)
 	}
+	if err := closeTrace(); err != nil {
+		log.Printf("could not write trace: %v", err)
+	}
+	if err := closeInputLog(); err != nil {
+		log.Printf("could not write input log: %v", err)
+	}
+	log.Println("Terminating VM")
+}
 
-	// Read origin
-	// The first 16 bits of the program file specify the address in memory where the
-	// program should start. This address is called the origin.
-	var origin uint16
+// loadProgram loads an object file, or assembles and loads an assembly
+// language source file, into memory. The symbol table is only returned for
+// source files.
+func loadProgram(cpu *lc3.CPU, path string) (uint16, lc3.SymbolTable, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".asm") {
+		origin, err := cpu.LoadROM(path)
+		return origin, nil, err
+	}
 
-	headerBytes := make([]byte, 2)
-	_, err = file.Read(headerBytes)
+	p, err := lc3.AssembleFile(path)
 	if err != nil {
-		return m, err
+		return 0, nil, err
 	}
+	cpu.Load(p)
+	return p.Origin, p.Symbols, nil
+}
 
-	headerBuffer := bytes.NewBuffer(headerBytes)
-	// LC-3 programs are big-endian, but most of the modern computers we use are little endian
-	err = binary.Read(headerBuffer, binary.BigEndian, &origin)
-	if err != nil {
-		return m, err
+// loadSymbols reads the symbol table for the program at path. Without an
+// explicit symbol file it looks for one next to the program.
+func loadSymbols(path, symPath string) lc3.SymbolTable {
+	if symPath == "" {
+		symPath = strings.TrimSuffix(path, filepath.Ext(path)) + ".sym"
+		if _, err := os.Stat(symPath); err != nil {
+			return lc3.SymbolTable{}
+		}
 	}
 
-	log.Printf("Origin memory location: 0x%04X", origin)
-	var size int64 = stats.Size()
-	byteArr := make([]byte, size)
+	log.Printf("Loading Symbols: %s", symPath)
+	symbols, err := lc3.LoadSymbols(symPath)
+	if err != nil {
+		log.Printf("could not read symbol table: %v", err)
+		return lc3.SymbolTable{}
+	}
+	return symbols
+}
 
-	log.Printf("Creating memory buffer: %d bytes", size)
+func getPath() string {
+	var arg string
+	args := flag.Args()
+	if len(args) > 0 {
+		arg = args[0]
+	}
 
-	_, err = file.Read(byteArr)
+	info, err := os.Stat(arg)
 	if err != nil {
-		return m, err
+		return ""
 	}
 
-	buffer := bytes.NewBuffer(byteArr)
-
-	for i := origin; i < math.MaxUint16; i++ {
-		var val uint16
-		binary.Read(buffer, binary.BigEndian, &val)
-		m[i] = val
+	if info.IsDir() {
+		log.Fatalln("A program file must be specified")
 	}
 
-	return m, err
+	return arg
 }
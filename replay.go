@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/robmorgan/go-lc3-vm/lc3"
+)
+
+// openInputLog creates an input recorder writing to the file at path. The
+// returned function flushes and closes the file.
+func openInputLog(path string) (lc3.InputRecorder, func() error, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := bufio.NewWriter(f)
+	closeLog := func() error {
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return lc3.NewInputLog(w), closeLog, nil
+}
+
+// loadInputLog reads the input events recorded in the file at path.
+func loadInputLog(path string) ([]lc3.InputEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return lc3.ReadInputLog(f)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+
+	"github.com/robmorgan/go-lc3-vm/lc3"
+)
+
+// saveSnapshot writes a snapshot of the stopped machine to path.
+func saveSnapshot(cpu *lc3.CPU, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := cpu.SaveSnapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// restoreSnapshot loads the snapshot at path into the machine.
+func restoreSnapshot(cpu *lc3.CPU, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return cpu.LoadSnapshot(f)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/robmorgan/go-lc3-vm/lc3"
+)
+
+// openTrace creates a tracer writing to the file at path in the given format.
+// The returned function flushes and closes the file.
+func openTrace(path, format string) (lc3.Tracer, func() error, error) {
+	if format != "jsonl" && format != "binary" {
+		return nil, nil, fmt.Errorf("unknown trace format %q, expected jsonl or binary", format)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := bufio.NewWriter(f)
+	closeTrace := func() error {
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	if format == "binary" {
+		return lc3.NewBinaryTracer(w), closeTrace, nil
+	}
+	return lc3.NewJSONTracer(w), closeTrace, nil
+}
+
+// runCompare runs the loaded program, comparing its execution with the
+// reference trace at path, which is either a trace written by -trace or the
+// output of lc3sim. It returns the exit status for the process.
+func runCompare(cpu *lc3.CPU, path, format string, inputPath string) int {
+	var read func(io.Reader) ([]lc3.TraceRecord, error)
+	switch format {
+	case "trace":
+		read = lc3.ReadTrace
+	case "lc3sim":
+		read = lc3.ReadLC3SimTrace
+	default:
+		log.Printf("unknown reference trace format %q, expected trace or lc3sim", format)
+		return exitError
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("could not open reference trace: %v", err)
+		return exitError
+	}
+	reference, err := read(f)
+	f.Close()
+	if err != nil {
+		log.Printf("could not read reference trace: %v", err)
+		return exitError
+	}
+
+	closeInput, err := startDebugConsole(cpu, inputPath, os.Stdout)
+	if err != nil {
+		log.Printf("could not open input file: %v", err)
+		return exitError
+	}
+	defer closeInput()
+
+	if err := cpu.CompareTrace(reference); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	log.Printf("Execution matches all %d instructions of the reference trace", len(reference))
+	return exitHalted
+}